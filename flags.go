@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"ytdlpWrapper/src"
+)
+
+// flagKind says whether a wrapper flag takes a value
+type flagKind int
+
+const (
+	boolFlag          flagKind = iota
+	valueFlag                  // Takes the next argument as its value
+	optionalValueFlag          // Takes the next argument unless it looks like a flag or URL
+)
+
+// wrapperFlag is a flag the wrapper handles itself instead of passing it through to yt-dlp
+type wrapperFlag struct {
+	name  string // Without dashes, both -name and --name are accepted
+	kind  flagKind
+	arg   string // Placeholder for the value in the usage
+	usage string
+	set   func(value string) // value is "" for boolFlag, and for optionalValueFlag without a value
+}
+
+// lookupFlag returns the wrapper flag arg names, if any
+func lookupFlag(flags []wrapperFlag, arg string) (wrapperFlag, bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return wrapperFlag{}, false
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	for _, f := range flags {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return wrapperFlag{}, false
+}
+
+// parseArgs applies the wrapper flags found in args and returns the remaining arguments,
+// which are passed through to yt-dlp. The first argument that isn't a flag is the URL,
+// unless one was already given; a value flag at the very end is ignored.
+//
+// The value of a yt-dlp option can't be told apart from the URL, so everything after a
+// "--" argument is passed through verbatim, e.g. URL -- --merge-output-format mp4
+func parseArgs(args []string, flags []wrapperFlag, url *string) []string {
+	var ytdlpArgs []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			return append(ytdlpArgs, args[i+1:]...)
+		}
+
+		f, ok := lookupFlag(flags, args[i])
+		if !ok {
+			if !strings.HasPrefix(args[i], "-") && *url == "" {
+				*url = args[i]
+			} else {
+				ytdlpArgs = append(ytdlpArgs, args[i])
+			}
+			continue
+		}
+
+		switch f.kind {
+		case boolFlag:
+			f.set("")
+		case valueFlag:
+			if i+1 < len(args) {
+				f.set(args[i+1])
+				i++
+			}
+		case optionalValueFlag:
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") && !strings.Contains(args[i+1], "://") {
+				f.set(args[i+1])
+				i++
+			} else {
+				f.set("")
+			}
+		}
+	}
+	return ytdlpArgs
+}
+
+// completionFlags describes the wrapper flags for src.CompletionScript
+func completionFlags(flags []wrapperFlag) []src.CompletionFlag {
+	completions := make([]src.CompletionFlag, len(flags))
+	for i, f := range flags {
+		completions[i] = src.CompletionFlag{Name: f.name, TakesValue: f.kind == valueFlag}
+	}
+	return completions
+}
+
+// printUsage lists the wrapper's own flags and how everything else reaches yt-dlp
+func printUsage(prog string, flags []wrapperFlag) {
+	fmt.Printf("Usage: %s [flags] [URL] [yt-dlp options] [-- yt-dlp options]\n\n", prog)
+	fmt.Println("Without a URL or mode flag the interactive TUI starts.")
+	fmt.Println("Flags work with one or two dashes. Options the wrapper doesn't know are passed to yt-dlp,")
+	fmt.Println("and so is everything after --, which is needed for yt-dlp options that take a value.")
+	fmt.Println()
+	fmt.Println("Flags:")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, f := range flags {
+		name := "-" + f.name
+		if f.arg != "" {
+			name += " " + f.arg
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", name, f.usage)
+	}
+	w.Flush()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	const url = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	tests := []struct {
+		name      string
+		args      []string
+		wantURL   string
+		wantSet   map[string]string
+		wantYtdlp []string
+	}{
+		{"url only", []string{url}, url, map[string]string{}, nil},
+		{
+			"flags before the url",
+			[]string{"-quiet", "--format", "mp3", url},
+			url, map[string]string{"quiet": "", "format": "mp3"}, nil,
+		},
+		{
+			"flags after the url",
+			[]string{url, "-format", "mp3", "--quiet"},
+			url, map[string]string{"quiet": "", "format": "mp3"}, nil,
+		},
+		{
+			"unknown flags pass through",
+			[]string{"--embed-metadata", url, "-quiet", "--no-mtime"},
+			url, map[string]string{"quiet": ""}, []string{"--embed-metadata", "--no-mtime"},
+		},
+		// Without --, a yt-dlp option's value is taken for the URL
+		{
+			"yt-dlp value before the url",
+			[]string{"--merge-output-format", "mp4", url},
+			"mp4", map[string]string{}, []string{"--merge-output-format", url},
+		},
+		{
+			"passthrough after --",
+			[]string{url, "-quiet", "--", "--merge-output-format", "mp4", "-quiet", "--", "x"},
+			url, map[string]string{"quiet": ""}, []string{"--merge-output-format", "mp4", "-quiet", "--", "x"},
+		},
+		{
+			"passthrough keeps earlier yt-dlp args first",
+			[]string{"--no-mtime", url, "--", "-f", "bv*+ba"},
+			url, map[string]string{}, []string{"--no-mtime", "-f", "bv*+ba"},
+		},
+		{"nothing after --", []string{url, "--"}, url, map[string]string{}, nil},
+		{"second url passes through", []string{url, "https://youtu.be/x"}, url, map[string]string{}, []string{"https://youtu.be/x"}},
+		{"value flag at the end", []string{url, "-format"}, url, map[string]string{}, nil},
+		{
+			"optional value given",
+			[]string{"-open", "vlc", url},
+			url, map[string]string{"open": "vlc"}, nil,
+		},
+		// An optional value never swallows the URL or a flag
+		{
+			"optional value left out",
+			[]string{"-open", url, "-open", "-quiet"},
+			url, map[string]string{"open": "", "quiet": ""}, nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := map[string]string{}
+			record := func(name string) func(string) {
+				return func(value string) { set[name] = value }
+			}
+			flags := []wrapperFlag{
+				{name: "quiet", kind: boolFlag, set: record("quiet")},
+				{name: "format", kind: valueFlag, set: record("format")},
+				{name: "open", kind: optionalValueFlag, set: record("open")},
+			}
+
+			var url string
+			got := parseArgs(tt.args, flags, &url)
+			if url != tt.wantURL {
+				t.Errorf("url = %q, want %q", url, tt.wantURL)
+			}
+			if !maps.Equal(set, tt.wantSet) {
+				t.Errorf("flags set = %v, want %v", set, tt.wantSet)
+			}
+			if !slices.Equal(got, tt.wantYtdlp) {
+				t.Errorf("yt-dlp args = %q, want %q", got, tt.wantYtdlp)
+			}
+		})
+	}
+}
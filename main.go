@@ -2,37 +2,537 @@ package main
 
 import (
 	"fmt"
+	neturl "net/url"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"time"
 
 	"ytdlpWrapper/src"
 )
 
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%d)"
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
 
 func main() {
-	// Parse command line arguments manually to allow all ytdlp flags to pass through
+	// Wrapper flags are parsed by hand so all other yt-dlp flags can pass through
 	var url string
 	var listMode bool
+	var listJSON bool
 	var listPlaylists bool
+	var listOrphans bool
+	var listChannels bool
+	var channelID string
+	var force bool
+	var doctor bool
+	var showVersion bool
+	var completionShell string
+	var showHelp bool
+	var updateYtdlp bool
+	var metadataOnly bool
+	var noPlaylist bool
+	var forcePlaylist bool
+	var forceSingle bool
+	var batchFile string
+	var playlistItems string
+	var formatsURL string
+	var exportCSV string
+	var importFile string
+	var showStats bool
+	var deletePlaylistID string
+	var resume bool
+	var resumeFailed bool
+	logLevel := "info"
+	var syncPlaylistID string
+	var syncAll bool
+	var popularPlaylistID string
+	var downloadPlaylistID string
+	var resumePlaylistID string
+	var serveAddr string
+	var cookiesBrowser string
+	var cookiesFile string
+	var sponsorBlockRemove string
+	var sponsorBlockMark string
+	var formatSort string
+	var container string
+	var liveFromStart bool
+	// YTDLP_WRAPPER_ARCHIVE enables the download archive by default
+	archivePath := os.Getenv("YTDLP_WRAPPER_ARCHIVE")
+	// YTDLP_WRAPPER_RATE_LIMIT sets a default bandwidth cap
+	rateLimit := os.Getenv("YTDLP_WRAPPER_RATE_LIMIT")
+	// YTDLP_WRAPPER_OUTPUT_TEMPLATE sets a default filename template
+	outputTemplate := os.Getenv("YTDLP_WRAPPER_OUTPUT_TEMPLATE")
+	var embedMetadata bool
+	var splitChapters bool
+	var maxFilesize, minFilesize string
+	var matchFilter string
+	var dryRun bool
+	var openAfter bool
+	var searchQuery string
+	var maxDownloads string
+	var cleanup bool
+	var purgeStatuses []src.DownloadStatus
+	var olderThan string
+	var since, until string
+	var syncInterval string
+	var archiveOnlyCompleted bool
+	var embedThumbnail bool
 	var ytdlpArgs []string
 
-	args := os.Args[1:]
-	for i := 0; i < len(args); i++ {
-		if args[i] == "-url" || args[i] == "--url" {
-			if i+1 < len(args) {
-				url = args[i+1]
-				i++
+	// YTDLP_WRAPPER_WEBHOOK sets a default webhook endpoint
+	src.WebhookURL = os.Getenv("YTDLP_WRAPPER_WEBHOOK")
+
+	flags := []wrapperFlag{
+		{"url", valueFlag, "URL", "Download a video, or save a playlist or channel (the URL can also be given without -url)", func(v string) { url = v }},
+		{"list", boolFlag, "", "List the download history", func(string) { listMode = true }},
+		{"list-json", boolFlag, "", "Print the download history as JSON, with playlist titles", func(string) { listJSON = true }},
+		{"since", valueFlag, "WHEN", "With -list or -list-json, only downloads since a date (2024-01-01) or duration ago (7d)", func(v string) { since = v }},
+		{"until", valueFlag, "WHEN", "With -list or -list-json, only downloads until a date or duration ago", func(v string) { until = v }},
+		{"list-playlists", boolFlag, "", "List saved playlists", func(string) { listPlaylists = true }},
+		{"list-orphans", boolFlag, "", "List downloads that don't belong to a playlist", func(string) { listOrphans = true }},
+		{"list-channels", boolFlag, "", "List the channels downloads and playlists came from", func(string) { listChannels = true }},
+		{"channel", valueFlag, "ID", "List the downloads of a channel", func(v string) { channelID = v }},
+		{"sync-playlist", valueFlag, "ID", "Save and download a playlist's new videos", func(v string) { syncPlaylistID = v }},
+		{"popular", valueFlag, "ID", "List a playlist's videos by view count", func(v string) { popularPlaylistID = v }},
+		{"resume-playlist", valueFlag, "ID", "Continue an interrupted playlist download", func(v string) { resumePlaylistID = v }},
+		{"download-playlist", valueFlag, "ID", "Download a saved playlist's videos", func(v string) { downloadPlaylistID = v }},
+		{"sync-all", boolFlag, "", "Sync every saved playlist", func(string) { syncAll = true }},
+		{"sync-interval", valueFlag, "DURATION", "With -serve, sync every saved playlist this often", func(v string) { syncInterval = v }},
+		{"serve", valueFlag, "ADDR", "Run the HTTP API on ADDR, e.g. :8080", func(v string) { serveAddr = v }},
+		{"log-level", valueFlag, "LEVEL", "Log file level: debug, info, warn or error", func(v string) { logLevel = v }},
+		{"resume", boolFlag, "", "Retry downloads left pending by an interrupted run", func(string) { resume = true }},
+		{"resume-failed", boolFlag, "", "Like -resume, and retry failed downloads too", func(string) { resume, resumeFailed = true, true }},
+		{"batch", valueFlag, "FILE", "Download every URL listed in FILE, one per line", func(v string) { batchFile = v }},
+		{"export-csv", valueFlag, "FILE", "Export the download history to a CSV file", func(v string) { exportCSV = v }},
+		{"delete-playlist", valueFlag, "ID", "Delete a saved playlist, keeping its downloads", func(v string) { deletePlaylistID = v }},
+		{"stats", boolFlag, "", "Show download statistics", func(string) { showStats = true }},
+		{"import", valueFlag, "FILE", "Save the playlists listed in a JSON or CSV file", func(v string) { importFile = v }},
+		{"formats", valueFlag, "URL", "List the formats available for a video", func(v string) { formatsURL = v }},
+		{"items", valueFlag, "SPEC", "Only save these playlist items, e.g. 1-10 or ::2", func(v string) { playlistItems = v }},
+		{"metadata-only", boolFlag, "", "Record videos without downloading them", func(string) { metadataOnly = true }},
+		{"update-ytdlp", boolFlag, "", "Update yt-dlp", func(string) { updateYtdlp = true }},
+		{"help", boolFlag, "", "Show this help", func(string) { showHelp = true }},
+		{"version", boolFlag, "", "Print the wrapper and yt-dlp versions", func(string) { showVersion = true }},
+		{"completion", valueFlag, "SHELL", "Print a completion script for bash, zsh or fish", func(v string) { completionShell = v }},
+		{"doctor", boolFlag, "", "Check the environment and the database", func(string) { doctor = true }},
+		{"no-playlist", boolFlag, "", "Download only the video of a URL opened from a playlist", func(string) { noPlaylist = true }},
+		{"playlist", boolFlag, "", "Treat the URL as a playlist", func(string) { forcePlaylist = true }},
+		{"single", boolFlag, "", "Treat the URL as a single video", func(string) { forceSingle = true }},
+		{"force", boolFlag, "", "Download again even if already downloaded", func(string) { force = true }},
+		{"cookies-browser", valueFlag, "BROWSER", "Use cookies from a browser, e.g. firefox or chrome:Profile 1", func(v string) { cookiesBrowser = v }},
+		{"cookies-file", valueFlag, "FILE", "Use cookies from a Netscape cookies file", func(v string) { cookiesFile = v }},
+		{"max-filesize", valueFlag, "SIZE", "Skip videos larger than SIZE, e.g. 500M", func(v string) { maxFilesize = v }},
+		{"min-filesize", valueFlag, "SIZE", "Skip videos smaller than SIZE", func(v string) { minFilesize = v }},
+		{"match-filter", valueFlag, "FILTER", "Skip videos not matching a yt-dlp filter, e.g. \"duration > 600\"", func(v string) { matchFilter = v }},
+		{"no-restrict-filenames", boolFlag, "", "Keep non-ASCII characters and spaces in filenames", func(string) { src.RestrictFilenames = false }},
+		{"yes", boolFlag, "", "Don't ask before saving large playlists", func(string) { src.AssumeYes = true }},
+		{"search-download", valueFlag, "QUERY", "Download the top search result for QUERY", func(v string) { searchQuery = v }},
+		{"reverse", boolFlag, "", "Download playlists last video first", func(string) { src.PlaylistReverse = true }},
+		{"max-downloads", valueFlag, "N", "Stop playlist and batch runs after N downloads", func(v string) { maxDownloads = v }},
+		{"purge-failed", boolFlag, "", "Delete failed downloads from the history", func(string) { purgeStatuses = append(purgeStatuses, src.StatusFailed) }},
+		{"purge-cancelled", boolFlag, "", "Delete cancelled downloads from the history", func(string) { purgeStatuses = append(purgeStatuses, src.StatusCancelled) }},
+		{"older-than", valueFlag, "DURATION", "With -purge-*, only records older than DURATION, e.g. 30d", func(v string) { olderThan = v }},
+		{"cleanup", boolFlag, "", "Remove stale partial download files", func(string) { cleanup = true }},
+		{"open", boolFlag, "", "Open the file after downloading", func(string) { openAfter = true }},
+		{"dry-run", boolFlag, "", "Print the yt-dlp command instead of running it", func(string) { dryRun = true }},
+		{"split-chapters", boolFlag, "", "Also split the video into one file per chapter", func(string) { splitChapters = true }},
+		{"info-json", boolFlag, "", "Store the video's description, tags and categories", func(string) { src.IngestInfoJSON = true }},
+		{"keep-info-json", boolFlag, "", "Like -info-json, and keep the .info.json file", func(string) { src.IngestInfoJSON, src.KeepInfoJSON = true, true }},
+		{"embed-metadata", boolFlag, "", "Embed metadata in the file", func(string) { embedMetadata = true }},
+		{"embed-thumbnail", boolFlag, "", "Embed the thumbnail in the file", func(string) { embedThumbnail = true }},
+		{"sponsorblock-remove", valueFlag, "CATS", "Remove SponsorBlock segments, e.g. sponsor,intro", func(v string) { sponsorBlockRemove = v }},
+		{"sponsorblock-mark", valueFlag, "CATS", "Mark SponsorBlock segments as chapters", func(v string) { sponsorBlockMark = v }},
+		{"webhook", valueFlag, "URL", "POST each finished download to URL", func(v string) { src.WebhookURL = v }},
+		{"notify", boolFlag, "", "Show a desktop notification when downloads finish", func(string) { src.NotifyEnabled = true }},
+		{"quiet", boolFlag, "", "Only print errors and the downloaded file's path", func(string) { src.Quiet = true }},
+		{"verbose", boolFlag, "", "Print yt-dlp's full output", func(string) { src.Verbose = true }},
+		{"by-channel", boolFlag, "", "Put downloads in a folder per channel", func(string) { src.OrganizeByChannel = true }},
+		{"output-template", valueFlag, "TEMPLATE", "yt-dlp filename template, default %(title)s.%(ext)s", func(v string) { outputTemplate = v }},
+		{"format-sort", valueFlag, "SPEC", "Prefer formats by these yt-dlp sort fields, e.g. res:1080,vcodec:av01", func(v string) { formatSort = v }},
+		{"container", valueFlag, "EXT", "Merge video and audio into mp4, mkv or webm", func(v string) { container = v }},
+		{"live-from-start", boolFlag, "", "Record live streams from the beginning instead of refusing them", func(string) { liveFromStart = true }},
+		{"rate-limit", valueFlag, "RATE", "Limit each download's bandwidth, e.g. 2M", func(v string) { rateLimit = v }},
+		{"archive-only-completed", boolFlag, "", "Only archive downloads once they have completed", func(string) { archiveOnlyCompleted = true }},
+		// The archive path is optional and defaults to downloads/archive.txt
+		{"archive", optionalValueFlag, "[FILE]", "Skip videos in the download archive, default downloads/archive.txt", func(v string) {
+			archivePath = src.DefaultArchivePath
+			if v != "" {
+				archivePath = v
 			}
-		} else if args[i] == "-list" || args[i] == "--list" {
-			listMode = true
-		} else if args[i] == "-list-playlists" || args[i] == "--list-playlists" {
-			listPlaylists = true
-		} else if !strings.HasPrefix(args[i], "-") && url == "" {
-			url = args[i]
+		}},
+	}
+	ytdlpArgs = parseArgs(os.Args[1:], flags, &url)
+
+	if showHelp {
+		printUsage(filepath.Base(os.Args[0]), flags)
+		return
+	}
+
+	if completionShell != "" {
+		script, err := src.CompletionScript(completionShell, filepath.Base(os.Args[0]), completionFlags(flags))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(script)
+		return
+	}
+
+	if showVersion {
+		fmt.Printf("ytdlpWrapper %s (commit %s, built %s)\n", version, commit, date)
+		if ytdlpVersion, err := src.GetYtdlpVersion(); err == nil {
+			fmt.Printf("yt-dlp %s\n", ytdlpVersion)
+		} else if !src.IsInstalled() {
+			fmt.Println("yt-dlp not installed")
 		} else {
-			ytdlpArgs = append(ytdlpArgs, args[i])
+			fmt.Printf("yt-dlp version unknown: %v\n", err)
+		}
+		return
+	}
+
+	// A search downloads its top result like any other single video URL
+	if searchQuery != "" {
+		if url != "" {
+			fmt.Fprintf(os.Stderr, "Error: -search-download and -url can't be used together\n")
+			os.Exit(1)
+		}
+		url = "ytsearch1:" + searchQuery
+	}
+
+	// Catch typos before yt-dlp turns them into a cryptic error
+	if url != "" {
+		if err := src.ValidateURL(url); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			// Most likely the value of a yt-dlp option, which can't be told apart from the URL
+			if len(ytdlpArgs) > 0 {
+				fmt.Fprintf(os.Stderr, "Pass yt-dlp options that take a value after --, e.g. %s URL -- --merge-output-format mp4\n", filepath.Base(os.Args[0]))
+			}
+			os.Exit(1)
+		}
+	}
+
+	if src.WebhookURL != "" {
+		if u, err := neturl.Parse(src.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Error: invalid webhook URL %q\n", src.WebhookURL)
+			os.Exit(1)
+		}
+	}
+
+	if src.Quiet && src.Verbose {
+		fmt.Fprintf(os.Stderr, "Error: -quiet and -verbose can't be used together\n")
+		os.Exit(1)
+	}
+	if src.Verbose {
+		ytdlpArgs = append(ytdlpArgs, "-v")
+	}
+
+	if outputTemplate != "" {
+		if err := src.SetOutputTemplate(outputTemplate); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if playlistItems != "" {
+		if err := src.ValidatePlaylistItems(playlistItems); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Cookies are only passed through to yt-dlp, never stored
+	if cookiesBrowser != "" {
+		if err := src.ValidateCookiesBrowser(cookiesBrowser); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		ytdlpArgs = append(ytdlpArgs, "--cookies-from-browser", cookiesBrowser)
+	}
+	if cookiesFile != "" {
+		if err := src.ValidateCookiesFile(cookiesFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		ytdlpArgs = append(ytdlpArgs, "--cookies", cookiesFile)
+	}
+
+	if sponsorBlockRemove != "" || sponsorBlockMark != "" {
+		if sponsorBlockRemove != "" {
+			if err := src.ValidateSponsorBlockCategories(sponsorBlockRemove, true); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			ytdlpArgs = append(ytdlpArgs, "--sponsorblock-remove", sponsorBlockRemove)
+		}
+		if sponsorBlockMark != "" {
+			if err := src.ValidateSponsorBlockCategories(sponsorBlockMark, false); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			ytdlpArgs = append(ytdlpArgs, "--sponsorblock-mark", sponsorBlockMark)
+		}
+		if url != "" && !src.IsYouTubeURL(url) {
+			fmt.Fprintf(os.Stderr, "Warning: SponsorBlock only works with YouTube URLs\n")
+		}
+	}
+
+	// The sort only orders the formats -f picks from, so the two combine
+	if formatSort != "" {
+		if err := src.ValidateFormatSort(formatSort); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		ytdlpArgs = append(ytdlpArgs, "--format-sort", formatSort)
+	}
+
+	if container != "" {
+		if err := src.ValidateContainer(container); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if warning := src.ContainerCodecWarning(container, ytdlpArgs); warning != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+		ytdlpArgs = append(ytdlpArgs, "--merge-output-format", container)
+	}
+
+	// yt-dlp ignores it for videos that aren't live
+	if liveFromStart && !src.HasArg(ytdlpArgs, "--live-from-start") {
+		ytdlpArgs = append(ytdlpArgs, "--live-from-start")
+	}
+
+	// The limit is per yt-dlp process; concurrent downloads each get the full rate
+	if rateLimit != "" {
+		if err := src.ValidateRateLimit(rateLimit); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		ytdlpArgs = append(ytdlpArgs, "--limit-rate", rateLimit)
+	}
+
+	// Sizes are passed to yt-dlp in bytes so both sides agree on the units.
+	// Videos outside the range finish as skipped instead of completed
+	var maxBytes, minBytes int64
+	if maxFilesize != "" {
+		n, err := src.ParseSize(maxFilesize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -max-filesize: %v\n", err)
+			os.Exit(1)
+		}
+		maxBytes = n
+		ytdlpArgs = append(ytdlpArgs, "--max-filesize", strconv.FormatInt(n, 10))
+	}
+	if minFilesize != "" {
+		n, err := src.ParseSize(minFilesize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -min-filesize: %v\n", err)
+			os.Exit(1)
+		}
+		minBytes = n
+		ytdlpArgs = append(ytdlpArgs, "--min-filesize", strconv.FormatInt(n, 10))
+	}
+	if maxBytes > 0 && minBytes > maxBytes {
+		fmt.Fprintf(os.Stderr, "Error: -min-filesize is larger than -max-filesize\n")
+		os.Exit(1)
+	}
+
+	var olderThanDuration time.Duration
+	if olderThan != "" {
+		d, err := src.ParseDuration(olderThan)
+		if err != nil || d <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -older-than %q (expected a duration such as 30d or 2w)\n", olderThan)
+			os.Exit(1)
+		}
+		olderThanDuration = d
+	}
+
+	// -since and -until narrow the listed history to a created_at window
+	if (since != "" || until != "") && !listMode && !listJSON {
+		fmt.Fprintf(os.Stderr, "Error: -since and -until can only be used with -list or -list-json\n")
+		os.Exit(1)
+	}
+	var sinceTime, untilTime time.Time
+	if since != "" {
+		t, _, err := src.ParseTimeBound(since, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -since: %v\n", err)
+			os.Exit(1)
+		}
+		sinceTime = t
+	}
+	if until != "" {
+		t, dateOnly, err := src.ParseTimeBound(until, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -until: %v\n", err)
+			os.Exit(1)
+		}
+		// A plain date includes that whole day
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		untilTime = t
+	}
+	if !sinceTime.IsZero() && !untilTime.IsZero() && !sinceTime.Before(untilTime) {
+		fmt.Fprintf(os.Stderr, "Error: -since must be earlier than -until\n")
+		os.Exit(1)
+	}
+
+	// Server mode syncs saved playlists on this interval
+	if syncInterval != "" {
+		if serveAddr == "" {
+			fmt.Fprintf(os.Stderr, "Error: -sync-interval can only be used with -serve\n")
+			os.Exit(1)
+		}
+		d, err := src.ParseDuration(syncInterval)
+		if err != nil || d < time.Minute {
+			fmt.Fprintf(os.Stderr, "Error: invalid -sync-interval %q (expected a duration of at least 1m, e.g. 6h)\n", syncInterval)
+			os.Exit(1)
+		}
+		src.SyncInterval = d
+	}
+
+	// Saved playlists are downloaded one video at a time in reverse, this covers a playlist URL
+	// handed to yt-dlp as a whole
+	if src.PlaylistReverse && !src.HasArg(ytdlpArgs, "--playlist-reverse") {
+		ytdlpArgs = append(ytdlpArgs, "--playlist-reverse")
+	}
+
+	// Playlist and batch runs stop after this many downloads
+	if maxDownloads != "" {
+		n, err := strconv.Atoi(maxDownloads)
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: -max-downloads must be a positive number, got %q\n", maxDownloads)
+			os.Exit(1)
+		}
+		src.MaxDownloads = n
+	}
+
+	// Applied to playlist extraction as well, so filtered-out videos are never saved
+	if matchFilter != "" {
+		if err := src.ValidateMatchFilter(matchFilter); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		src.MatchFilter = matchFilter
+	}
+
+	if forcePlaylist && forceSingle {
+		fmt.Fprintf(os.Stderr, "Error: -playlist and -single can't be used together\n")
+		os.Exit(1)
+	}
+	// A URL forced to be a single video never downloads the playlist around it
+	if forceSingle {
+		noPlaylist = true
+	}
+	if noPlaylist {
+		ytdlpArgs = append(ytdlpArgs, "--no-playlist")
+	}
+
+	if src.IngestInfoJSON && !src.HasArg(ytdlpArgs, "--write-info-json") {
+		ytdlpArgs = append(ytdlpArgs, "--write-info-json")
+	}
+
+	if archivePath != "" && !src.HasArg(ytdlpArgs, "--download-archive") {
+		if err := src.EnsureArchiveFile(archivePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating archive file: %v\n", err)
+			os.Exit(1)
+		}
+		ytdlpArgs = append(ytdlpArgs, "--download-archive", archivePath)
+	}
+	if archiveOnlyCompleted {
+		if !src.HasArg(ytdlpArgs, "--download-archive") {
+			fmt.Fprintf(os.Stderr, "Warning: -archive-only-completed has no effect without -archive\n")
+		}
+		src.ArchiveOnlyCompleted = true
+	}
+
+	if embedMetadata {
+		ytdlpArgs = append(ytdlpArgs, "--embed-metadata")
+	}
+	// With -x each chapter becomes its own audio file
+	if splitChapters && !src.HasArg(ytdlpArgs, "--split-chapters") {
+		ytdlpArgs = append(ytdlpArgs, "--split-chapters")
+	}
+	if embedThumbnail {
+		if warning := src.ThumbnailEmbedWarning(ytdlpArgs); warning != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+		ytdlpArgs = append(ytdlpArgs, "--embed-thumbnail")
+		// Most containers can't hold webp cover art, so convert unless the user chose a format
+		if !src.HasArg(ytdlpArgs, "--convert-thumbnails") {
+			ytdlpArgs = append(ytdlpArgs, "--convert-thumbnails", "jpg")
+		}
+	}
+
+	// Updating yt-dlp doesn't touch the database
+	if updateYtdlp {
+		if err := src.UpdateYtdlp(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Listing formats doesn't touch the database
+	if formatsURL != "" {
+		if !src.IsInstalled() {
+			fmt.Fprintf(os.Stderr, "Error: yt-dlp is not installed\n")
+			os.Exit(1)
 		}
+		if err := src.ListFormats(formatsURL); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// YTDLP_WRAPPER_METADATA_TIMEOUT and YTDLP_WRAPPER_PLAYLIST_TIMEOUT override the extraction timeouts
+	for env, timeout := range map[string]*time.Duration{
+		"YTDLP_WRAPPER_METADATA_TIMEOUT": &src.MetadataTimeout,
+		"YTDLP_WRAPPER_PLAYLIST_TIMEOUT": &src.PlaylistTimeout,
+	} {
+		if value := os.Getenv(env); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				fmt.Fprintf(os.Stderr, "Error: invalid %s %q (expected a duration such as 90s or 5m)\n", env, value)
+				os.Exit(1)
+			}
+			*timeout = d
+		}
+	}
+
+	// Cleaning up partial files doesn't touch the database. With -dry-run it only lists them
+	if cleanup {
+		if err := src.CleanupPartFiles("downloads", dryRun); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// A dry run only prints the download command, so it doesn't touch the database
+	if dryRun {
+		if url == "" {
+			fmt.Fprintf(os.Stderr, "Error: -dry-run needs a video URL (-url)\n")
+			os.Exit(1)
+		}
+		url = src.SingleVideoURL(url, noPlaylist)
+		if forcePlaylist || (!forceSingle && src.IsPlaylist(url)) {
+			fmt.Fprintf(os.Stderr, "Error: -dry-run only works for single videos, use -single to treat the URL as one\n")
+			os.Exit(1)
+		}
+		src.DryRun = true
+		if err := src.DryRunDownload(url, ytdlpArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	// Ensure required directories exist
@@ -45,8 +545,30 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Initialize database
+	level, err := src.ParseLogLevel(logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	logFile, err := src.InitLogger(filepath.Join("downloads", "ytdlpWrapper.log"), level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening log file: %v\n", err)
+		os.Exit(1)
+	}
+	defer logFile.Close()
+
 	dbPath := filepath.Join(".", "db", "data.db")
+
+	// The doctor opens the database itself so it can report failures
+	if doctor {
+		if err := src.RunDoctor(dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Initialize database
 	db, err := src.Open(dbPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
@@ -56,7 +578,15 @@ func main() {
 
 	// Handle different modes
 	if listMode {
-		if err := src.ListDownloads(db); err != nil {
+		if err := src.ListDownloads(db, sinceTime, untilTime); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if listJSON {
+		if err := src.ListDownloadsJSON(db, sinceTime, untilTime); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -71,26 +601,182 @@ func main() {
 		return
 	}
 
+	if deletePlaylistID != "" {
+		if err := src.DeletePlaylist(db, deletePlaylistID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if showStats {
+		if err := src.PrintStats(db); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if exportCSV != "" {
+		if err := src.ExportDownloadsCSV(db, exportCSV); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if importFile != "" {
+		if err := src.ImportPlaylists(db, importFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if listOrphans {
+		if err := src.ListOrphanDownloads(db); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if listChannels {
+		if err := src.ListChannels(db); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if channelID != "" {
+		if err := src.ListChannelDownloads(db, channelID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if resume {
+		if err := src.ResumeDownloads(db, ytdlpArgs, resumeFailed); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if syncPlaylistID != "" {
+		if err := src.SyncPlaylist(db, syncPlaylistID, ytdlpArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if resumePlaylistID != "" {
+		if err := src.ResumePlaylist(db, resumePlaylistID, ytdlpArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if downloadPlaylistID != "" {
+		if err := src.DownloadPlaylist(db, downloadPlaylistID, ytdlpArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(purgeStatuses) > 0 {
+		if err := src.PurgeDownloads(db, purgeStatuses, olderThanDuration); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if popularPlaylistID != "" {
+		if err := src.ListPopularVideos(db, popularPlaylistID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if syncAll {
+		if err := src.SyncAllPlaylists(db, ytdlpArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if serveAddr != "" {
+		if err := src.Serve(serveAddr, db, ytdlpArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if batchFile != "" {
+		if err := src.RunBatch(batchFile, ytdlpArgs, db, force, metadataOnly); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		// A batch has many files, open the folder they're in
+		if openAfter && !metadataOnly {
+			if err := src.OpenFile("downloads"); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to open downloads folder: %v\n", err)
+			}
+		}
+		return
+	}
+
 	if url != "" {
-		// Check if it's a playlist/channel URL or a single video
-		if src.IsPlaylistURL(url) {
+		// A video opened from a playlist is downloaded on its own with -no-playlist
+		url = src.SingleVideoURL(url, noPlaylist)
+		if src.IsWatchWithPlaylist(url) && !forcePlaylist {
+			fmt.Fprintf(os.Stderr, "Note: this video was opened from a playlist, saving the whole playlist. Use -no-playlist to download only the video\n")
+		}
+
+		// Check if it's a playlist/channel URL or a single video, unless forced either way
+		isPlaylist := forcePlaylist
+		if !forcePlaylist && !forceSingle {
+			isPlaylist = src.IsPlaylist(url)
+		}
+		if isPlaylist {
 			// Store playlist/channel videos in DB without downloading
-			if err := src.ExtractPlaylistToDB(url, db); err != nil {
+			if err := src.ExtractPlaylistItemsToDB(url, playlistItems, db); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		} else if metadataOnly {
+			// Single video - record it without downloading
+			if err := src.SaveMetadataOnly(url, db); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
 		} else {
 			// Single video - download immediately
-			if err := src.RunHeadless(url, ytdlpArgs, db); err != nil {
+			downloadID, err := src.RunHeadless(url, ytdlpArgs, db, force)
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
+			if openAfter {
+				if err := src.OpenDownload(db, downloadID); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to open download: %v\n", err)
+				}
+			}
 		}
 		return
 	}
 
 	// Otherwise, run TUI mode
-	p := src.NewProgram(db)
+	p := src.NewProgram(db, ytdlpArgs)
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error: %v", err)
 		os.Exit(1)
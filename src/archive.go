@@ -0,0 +1,131 @@
+package src
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ArchiveOnlyCompleted makes each download write to a temporary copy of the download archive.
+// Only the IDs of downloads that pass our completion check are merged into the real archive,
+// so a video yt-dlp archived before a failed post-processing step is retried next time
+var ArchiveOnlyCompleted bool
+
+// archiveMu serializes reading and appending to archives across concurrent downloads
+var archiveMu sync.Mutex
+
+// stagedArchive is a temporary copy of a download archive that yt-dlp writes to
+type stagedArchive struct {
+	path     string // The real archive
+	tempPath string
+}
+
+// stageArchive copies the --download-archive in args to a temporary file and returns args
+// pointing at the copy. Returns a nil archive and args unchanged if there is no archive
+func stageArchive(args []string) (*stagedArchive, []string, error) {
+	path := ArgValue(args, "--download-archive")
+	if path == "" {
+		return nil, args, nil
+	}
+
+	archiveMu.Lock()
+	data, err := os.ReadFile(path)
+	archiveMu.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, args, err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".archive-*.tmp")
+	if err != nil {
+		return nil, args, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, args, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return nil, args, err
+	}
+
+	staged := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--download-archive" && i+1 < len(args):
+			staged = append(staged, args[i], f.Name())
+			i++
+		case strings.HasPrefix(args[i], "--download-archive="):
+			staged = append(staged, "--download-archive="+f.Name())
+		default:
+			staged = append(staged, args[i])
+		}
+	}
+	return &stagedArchive{path: path, tempPath: f.Name()}, staged, nil
+}
+
+// commit appends the entries yt-dlp added to the temporary copy to the real archive
+func (a *stagedArchive) commit() error {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	existing, err := readArchiveLines(a.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	known := make(map[string]bool, len(existing))
+	for _, line := range existing {
+		known[line] = true
+	}
+
+	staged, err := readArchiveLines(a.tempPath)
+	if err != nil {
+		return err
+	}
+	var added []string
+	for _, line := range staged {
+		if !known[line] {
+			known[line] = true
+			added = append(added, line)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, strings.Join(added, "\n")); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// discard removes the temporary copy
+func (a *stagedArchive) discard() {
+	os.Remove(a.tempPath)
+}
+
+// readArchiveLines returns the non-empty lines of an archive file
+func readArchiveLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
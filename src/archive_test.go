@@ -0,0 +1,120 @@
+package src
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStageArchive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "archive.txt")
+
+	tests := []struct {
+		name     string
+		args     []string
+		existing string // The real archive's contents, "" for no archive file
+		yt       string // What yt-dlp appends to the staged copy
+		other    string // What another download commits meanwhile
+		want     []string
+	}{
+		{
+			"separate value", []string{"--newline", "--download-archive", path, "-f", "b"},
+			"youtube aaaaaaaaaaa\n", "youtube bbbbbbbbbbb\n", "",
+			[]string{"youtube aaaaaaaaaaa", "youtube bbbbbbbbbbb"},
+		},
+		{
+			"equals form", []string{"--download-archive=" + path},
+			"youtube aaaaaaaaaaa\n", "youtube bbbbbbbbbbb\n", "",
+			[]string{"youtube aaaaaaaaaaa", "youtube bbbbbbbbbbb"},
+		},
+		{
+			"no archive yet", []string{"--download-archive", path},
+			"", "youtube aaaaaaaaaaa\n", "",
+			[]string{"youtube aaaaaaaaaaa"},
+		},
+		// Entries another download committed after staging are kept, and not duplicated
+		{
+			"concurrent commit", []string{"--download-archive", path},
+			"youtube aaaaaaaaaaa\n", "youtube bbbbbbbbbbb\nyoutube ccccccccccc\n", "youtube ccccccccccc\nyoutube ddddddddddd\n",
+			[]string{"youtube aaaaaaaaaaa", "youtube ccccccccccc", "youtube ddddddddddd", "youtube bbbbbbbbbbb"},
+		},
+		{
+			"nothing new", []string{"--download-archive", path},
+			"youtube aaaaaaaaaaa\n", "", "",
+			[]string{"youtube aaaaaaaaaaa"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(path)
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			archive, args, err := stageArchive(tt.args)
+			if err != nil {
+				t.Fatalf("stageArchive: %v", err)
+			}
+			defer archive.discard()
+
+			// Only the archive path changes, and it points at the copy
+			staged := ArgValue(args, "--download-archive")
+			if staged == path || filepath.Dir(staged) != dir {
+				t.Fatalf("staged archive = %q, want a copy next to %q", staged, path)
+			}
+			if len(args) != len(tt.args) {
+				t.Errorf("args = %q, want %q with the archive replaced", args, tt.args)
+			}
+			if data, err := os.ReadFile(staged); err != nil || string(data) != tt.existing {
+				t.Errorf("staged copy = %q, %v, want %q", data, err, tt.existing)
+			}
+
+			appendFile(t, staged, tt.yt)
+			appendFile(t, path, tt.other)
+			if err := archive.commit(); err != nil {
+				t.Fatalf("commit: %v", err)
+			}
+
+			got, err := readArchiveLines(path)
+			if err != nil {
+				t.Fatalf("reading the archive: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("archive = %q, want %q", got, tt.want)
+			}
+
+			archive.discard()
+			if _, err := os.Stat(staged); !os.IsNotExist(err) {
+				t.Errorf("staged copy still exists after discard: %v", err)
+			}
+		})
+	}
+
+	// Without an archive there's nothing to stage
+	args := []string{"--newline", "-f", "b"}
+	archive, got, err := stageArchive(args)
+	if archive != nil || err != nil || !slices.Equal(got, args) {
+		t.Errorf("stageArchive without an archive = %v, %q, %v, want nil and the args unchanged", archive, got, err)
+	}
+}
+
+// appendFile appends s to the file at path, creating it if needed
+func appendFile(t *testing.T, path, s string) {
+	t.Helper()
+	if s == "" {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,45 +1,222 @@
 package src
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
 )
 
+// Output verbosity for headless runs, set from -quiet and -verbose.
+// Quiet mode only prints errors and the path of each finished download
 var (
-	progressRegex    = regexp.MustCompile(`(\d+\.?\d*)%`)
-	etaRegex         = regexp.MustCompile(`ETA\s+(\d{2}:\d{2}(?::\d{2})?)`)
-	destinationRegex = regexp.MustCompile(`\[download\] Destination: (.+)`)
+	Quiet   bool
+	Verbose bool
 )
 
-func RunHeadless(url string, ytdlpArgs []string, db *DB) error {
+// infof prints progress information unless running quietly
+func infof(format string, a ...interface{}) {
+	if !Quiet {
+		fmt.Printf(format, a...)
+	}
+}
+
+// infoln prints a line of progress information unless running quietly
+func infoln(a ...interface{}) {
+	if !Quiet {
+		fmt.Println(a...)
+	}
+}
+
+// downloadOutput is where a download prints its progress and warnings. A silent one only
+// logs the warnings, for downloads running behind the TUI, which owns the terminal
+type downloadOutput struct {
+	silent bool
+}
+
+func (o downloadOutput) infof(format string, a ...interface{}) {
+	if !o.silent {
+		infof(format, a...)
+	}
+}
+
+func (o downloadOutput) infoln(a ...interface{}) {
+	if !o.silent {
+		infoln(a...)
+	}
+}
+
+// warnf prints a warning to stderr, format is what follows "Warning: "
+func (o downloadOutput) warnf(format string, a ...interface{}) {
+	if o.silent {
+		logger.Warn(strings.TrimSuffix(fmt.Sprintf(format, a...), "\n"))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: "+format, a...)
+}
+
+// ErrDownloadCancelled is returned when the user interrupts a download
+var ErrDownloadCancelled = errors.New("download cancelled")
+
+// RunHeadless downloads a single video and returns the ID of its download record
+func RunHeadless(url string, ytdlpArgs []string, db *DB, force bool) (string, error) {
+	return RunHeadlessWithFormat(url, "", ytdlpArgs, db, force)
+}
+
+// RunHeadlessWithFormat downloads a single video in the given yt-dlp format.
+// An empty format lets yt-dlp pick the best one. Returns the ID of the download record,
+// which is the earlier download's when the video was already downloaded
+func RunHeadlessWithFormat(url, format string, ytdlpArgs []string, db *DB, force bool) (string, error) {
+	downloadID, _, err := runHeadless(url, format, ytdlpArgs, db, force)
+	return downloadID, err
+}
+
+// runHeadless is RunHeadlessWithFormat, also reporting whether this run completed a download.
+// Videos downloaded earlier and downloads skipped by a filter don't count
+func runHeadless(url, format string, ytdlpArgs []string, db *DB, force bool) (string, bool, error) {
 	if !IsInstalled() {
-		return fmt.Errorf("yt-dlp is not installed")
+		return "", false, fmt.Errorf("yt-dlp is not installed")
+	}
+
+	// A search is resolved first, so the history check below sees the video it found
+	if query, ok := SearchQuery(url); ok {
+		infof("Searching: %s\n", query)
+		result, err := ResolveSearch(query)
+		if err != nil {
+			return "", false, fmt.Errorf("search failed: %w", err)
+		}
+		infof("Found: %s\n", result.Title)
+		url = NormalizeURL(result.URL)
+	}
+
+	// Skip URLs that were already downloaded unless forced
+	if !force {
+		existing, err := db.GetCompletedDownloadByURL(url)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to check download history: %v\n", err)
+		} else if existing != nil {
+			infof("Already downloaded: %s\n", existing.Title)
+			infof("Downloaded on %s\n", existing.UpdatedAt.Format("2006-01-02 15:04:05"))
+			infoln("Use -force to download it again")
+			return existing.ID, false, nil
+		}
+
+		// Not downloaded yet, but an earlier attempt may have failed
+		if last, err := db.GetDownloadByURL(url); err == nil && last != nil && last.Status == StatusFailed {
+			infof("Retrying, the last attempt on %s failed\n", last.UpdatedAt.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	downloadID, err := downloadVideo(url, format, ytdlpArgs, db, "")
+	title, status := url, StatusFailed
+	if d, dbErr := db.GetDownload(downloadID); dbErr == nil {
+		status = d.Status
+		if d.Title != "" {
+			title = d.Title
+		}
+	}
+	if !errors.Is(err, ErrDownloadCancelled) {
+		notifyDownload(title, status, err)
+	}
+	return downloadID, err == nil && status == StatusCompleted, err
+}
+
+// OpenDownload opens the file of a download with the default application.
+// Nothing is opened unless the download completed
+func OpenDownload(db *DB, downloadID string) error {
+	d, err := db.GetDownload(downloadID)
+	if err != nil {
+		return fmt.Errorf("failed to look up download: %w", err)
+	}
+	if d.Status != StatusCompleted || d.FilePath == "" {
+		return nil
+	}
+	return OpenFile(d.FilePath)
+}
+
+// downloadVideo downloads a single video and records it, linked to playlistID if non-empty.
+// Ctrl+C cancels the download. Returns the ID of the download record
+func downloadVideo(url, format string, ytdlpArgs []string, db *DB, playlistID string) (string, error) {
+	downloadID, err := createDownload(db, url, playlistID)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	// Playlist runs keep partial files when interrupted so resuming the playlist continues them
+	return downloadID, executeDownload(ctx, db, downloadID, url, format, ytdlpArgs, playlistID != "", downloadOutput{})
+}
+
+// interruptContext returns a context that is cancelled on Ctrl+C or SIGTERM
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// createDownload inserts a pending download record for url
+func createDownload(db *DB, url, playlistID string) (string, error) {
+	downloadID, err := db.InsertDownloadWithPlaylist(NormalizeURL(url), "", playlistID)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert download record: %w", err)
 	}
+	return downloadID, nil
+}
 
+// executeDownload fills in the metadata of a pending download record and runs it.
+// Cancelling ctx cancels the download. Partial files are kept when keepPartial is set,
+// and progress and warnings go to out
+func executeDownload(ctx context.Context, db *DB, downloadID, url, format string, ytdlpArgs []string, keepPartial bool, out downloadOutput) error {
 	downloadsDir, err := ensureDownloadsFolder()
 	if err != nil {
+		db.UpdateDownloadStatus(downloadID, StatusFailed, "", err.Error())
 		return fmt.Errorf("failed to create downloads folder: %w", err)
 	}
 
-	fmt.Printf("Downloading: %s\n", url)
-	fmt.Printf("Destination: %s\n\n", downloadsDir)
+	// A search is resolved to its top result first, and the record then points at that video
+	if query, ok := SearchQuery(url); ok {
+		out.infof("Searching: %s\n", query)
+		result, err := ResolveSearch(query)
+		if err != nil {
+			db.UpdateDownloadStatus(downloadID, StatusFailed, "", err.Error())
+			return fmt.Errorf("search failed: %w", err)
+		}
+		url = NormalizeURL(result.URL)
+		if err := db.UpdateDownloadURL(downloadID, url); err != nil {
+			out.warnf("failed to update download URL: %v\n", err)
+		}
+		if result.Title != "" {
+			db.UpdateDownloadTitle(downloadID, result.Title)
+		}
+		out.infof("Found: %s\n", result.Title)
+	}
+
+	out.infof("Downloading: %s\n", url)
+	out.infof("Destination: %s\n\n", downloadsDir)
 
 	// Extract video metadata first
 	videoInfo, err := ExtractVideoMetadata(url)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to extract metadata: %v\n", err)
+		out.warnf("failed to extract metadata: %v\n", err)
 		videoInfo = &VideoInfo{URL: url} // Continue with minimal info
 	}
 
-	downloadID, err := db.InsertDownload(url, videoInfo.Title)
-	if err != nil {
-		return fmt.Errorf("failed to insert download record: %w", err)
+	if videoInfo.Title != "" {
+		db.UpdateDownloadTitle(downloadID, videoInfo.Title)
 	}
 
 	// Update channel info if available
@@ -49,291 +226,1601 @@ func RunHeadless(url string, ytdlpArgs []string, db *DB) error {
 	if videoInfo.ChannelURL != "" {
 		db.UpdateDownloadChannelURL(downloadID, videoInfo.ChannelURL)
 	}
+	if err := db.LinkDownloadChannel(downloadID, videoInfo.Channel, videoInfo.ChannelURL); err != nil {
+		out.warnf("failed to save channel: %v\n", err)
+	}
+	if videoInfo.Duration > 0 {
+		db.UpdateDownloadDuration(downloadID, videoInfo.Duration)
+	}
+	if videoInfo.UploadDate != "" {
+		db.UpdateDownloadUploadDate(downloadID, videoInfo.UploadDate)
+	}
+	if videoInfo.ID != "" && IsYouTubeURL(url) {
+		db.UpdateDownloadVideoID(downloadID, videoInfo.ID)
+	}
+	if videoInfo.LiveStatus != "" {
+		db.UpdateDownloadLiveStatus(downloadID, videoInfo.LiveStatus)
+		if err := checkLiveStatus(videoInfo, ytdlpArgs); err != nil {
+			db.UpdateDownloadStatus(downloadID, StatusFailed, "", err.Error())
+			return err
+		}
+	}
+
+	if OrganizeByChannel {
+		downloadsDir = filepath.Join(downloadsDir, channelFolder(videoInfo))
+		if err := os.MkdirAll(downloadsDir, 0755); err != nil {
+			db.UpdateDownloadStatus(downloadID, StatusFailed, "", err.Error())
+			return fmt.Errorf("failed to create channel folder: %w", err)
+		}
+	}
+
+	return runDownload(ctx, db, downloadID, url, format, downloadsDir, ytdlpArgs, keepPartial, out)
+}
 
-	// Setup signal handling for Ctrl+C
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// checkLiveStatus refuses streams that can't be downloaded as they are. Without --live-from-start
+// yt-dlp records a live stream from now until it ends, and an upcoming stream or premiere
+// can only be waited for with --wait-for-video
+func checkLiveStatus(info *VideoInfo, ytdlpArgs []string) error {
+	switch info.LiveStatus {
+	case liveStatusLive:
+		if !HasArg(ytdlpArgs, "--live-from-start") {
+			return fmt.Errorf("this is a live stream that hasn't ended, use -live-from-start to record it from the beginning")
+		}
+	case liveStatusUpcoming:
+		if !HasArg(ytdlpArgs, "--wait-for-video") {
+			when := "hasn't started yet"
+			if !info.StartsAt.IsZero() {
+				when = "starts " + info.StartsAt.Format("2006-01-02 15:04")
+			}
+			return fmt.Errorf("this is a scheduled stream or premiere that %s, pass -- --wait-for-video 60 to wait for it", when)
+		}
+	}
+	return nil
+}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+// OrganizeByChannel places each download in a subfolder named after its channel
+var OrganizeByChannel bool
 
-	cancelled := false
-	go func() {
-		<-sigChan
-		fmt.Println("\n\nCancelling download...")
-		cancelled = true
-		cancel()
-	}()
+// unknownChannelFolder collects downloads whose channel couldn't be determined
+const unknownChannelFolder = "Unknown_Channel"
 
-	// Add --newline flag to force ytdlp to output progress on new lines
-	ytdlpArgs = append([]string{"--newline"}, ytdlpArgs...)
+// channelFolder returns a filesystem-safe folder name for a video's channel
+func channelFolder(info *VideoInfo) string {
+	channel := info.Channel
+	if channel == "" || channel == "NA" || channel == "Unknown Channel" {
+		channel = ""
+	}
 
-	opts := DownloadOptions{
-		URL:        url,
-		OutputPath: filepath.Join(downloadsDir, "%(title)s.%(ext)s"),
-		ExtraArgs:  ytdlpArgs,
-		Context:    ctx,
-	}
-
-	var lastOutput string
-	var videoTitle, videoChannel string
-
-	err = DownloadWithCallback(opts, func(line string) {
-		// Extract title from destination line
-		if videoTitle == "" {
-			if matches := destinationRegex.FindStringSubmatch(line); len(matches) > 1 {
-				fullPath := matches[1]
-				filename := filepath.Base(fullPath)
-				ext := filepath.Ext(filename)
-				videoTitle = strings.TrimSuffix(filename, ext)
-				db.UpdateDownloadTitle(downloadID, videoTitle)
-			}
+	// Channels with non-ASCII names fall back to their handle or ID from the URL
+	fallback := ""
+	if info.ChannelURL != "" {
+		if name := extractChannelNameFromURL(info.ChannelURL); name != "Unknown Channel" {
+			fallback = name
 		}
+	}
+
+	if folder := NormalizeFilename(channel); folder != "" {
+		return folder
+	}
+	if folder := NormalizeFilename(fallback); folder != "" {
+		return folder
+	}
+	return unknownChannelFolder
+}
 
-		// Extract channel info
-		if videoChannel == "" && strings.Contains(line, "[info]") && strings.Contains(line, "Extracting URL:") {
-			// This is a simple heuristic - ytdlp doesn't easily expose channel in progress output
-			// Channel will be captured more reliably from playlist extraction
+// hasChapterTemplate checks if the yt-dlp args already name chapter files with -o chapter:...
+func hasChapterTemplate(args []string) bool {
+	for i, arg := range args {
+		if (arg == "-o" || arg == "--output") && i+1 < len(args) && strings.HasPrefix(args[i+1], "chapter:") {
+			return true
 		}
+	}
+	return false
+}
 
-		// Look for download progress lines
-		if strings.Contains(line, "[download]") && strings.Contains(line, "%") {
-			var progress, eta string
+// headlessReporter prints a download's progress to the terminal and records
+// the files yt-dlp writes for a download record
+type headlessReporter struct {
+	db         *DB
+	downloadID string
+	out        downloadOutput
 
-			if matches := progressRegex.FindStringSubmatch(line); len(matches) > 0 {
-				progress = matches[1]
-			}
+	lastOutput   string
+	title        string
+	finalPath    string   // Last file written, whose size is recorded
+	destinations []string // Every file yt-dlp started writing, for cleaning up partials
+	infoJSON     string   // Sidecar yt-dlp reported writing, if any
+	chapters     []string // Files written by --split-chapters
+	skipReason   string   // Why yt-dlp skipped the video without downloading, if it did
+}
 
-			if matches := etaRegex.FindStringSubmatch(line); len(matches) > 0 {
-				eta = matches[1]
-			}
+func (r *headlessReporter) OnProgress(pct float64, eta, speed string) {
+	output := fmt.Sprintf("Progress: %.1f%%", pct)
+	if speed != "" {
+		output += fmt.Sprintf(" | %s", speed)
+	}
+	if eta != "" {
+		output += fmt.Sprintf(" | ETA: %s", eta)
+	}
 
-			if progress != "" {
-				output := fmt.Sprintf("Progress: %s%%", progress)
-				if eta != "" {
-					output += fmt.Sprintf(" | ETA: %s", eta)
-				}
+	if output != r.lastOutput {
+		r.out.infof("\r%-60s", output)
+		r.lastOutput = output
+	}
+}
 
-				if output != lastOutput {
-					fmt.Printf("\r%-60s", output)
-					lastOutput = output
-				}
-			}
-		}
-	})
+func (r *headlessReporter) OnFragment(fragment int, speed string) {
+	output := fmt.Sprintf("Fragment %d", fragment)
+	if speed != "" {
+		output += fmt.Sprintf(" | %s", speed)
+	}
 
-	fmt.Println()
+	if output != r.lastOutput {
+		r.out.infof("\r%-60s", output)
+		r.lastOutput = output
+	}
+}
 
-	if err != nil {
-		if cancelled {
-			// Clean up .part files
-			cleanupPartFiles(downloadsDir)
-			if dbErr := db.UpdateDownloadStatus(downloadID, StatusCancelled, "", "Download cancelled by user"); dbErr != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to update download status: %v\n", dbErr)
-			}
-			return fmt.Errorf("download cancelled")
-		}
+func (r *headlessReporter) OnDestination(path string) {
+	r.finalPath = path
+	r.destinations = append(r.destinations, path)
 
-		// Clean up .part files on failure too
-		cleanupPartFiles(downloadsDir)
-		if dbErr := db.UpdateDownloadStatus(downloadID, StatusFailed, "", err.Error()); dbErr != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to update download status: %v\n", dbErr)
-		}
-		return fmt.Errorf("download failed: %w", err)
+	// The first file's name is the best title until metadata says otherwise
+	if r.title == "" {
+		filename := filepath.Base(path)
+		r.title = strings.TrimSuffix(filename, filepath.Ext(filename))
+		r.db.UpdateDownloadTitle(r.downloadID, r.title)
 	}
+}
 
-	if err := db.UpdateDownloadStatus(downloadID, StatusCompleted, filepath.Join(downloadsDir, "%(title)s.%(ext)s"), ""); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to update download status: %v\n", err)
+func (r *headlessReporter) OnLine(raw string) {
+	if matches := infoJSONRegex.FindStringSubmatch(raw); len(matches) > 1 {
+		r.infoJSON = matches[1]
+	}
+	if matches := chapterFileRegex.FindStringSubmatch(raw); len(matches) > 1 {
+		r.chapters = append(r.chapters, matches[1])
+	}
+	if matches := skippedRegex.FindStringSubmatch(raw); len(matches) > 1 {
+		r.skipReason = matches[1]
+	}
+	if Verbose && !r.out.silent {
+		fmt.Println(raw)
 	}
+}
 
-	fmt.Println("✓ Download completed successfully!")
-	return nil
+// downloadOptions returns the yt-dlp options for downloading url into downloadsDir
+func downloadOptions(url, format, downloadsDir string, ytdlpArgs []string) DownloadOptions {
+	// Add --newline flag to force ytdlp to output progress on new lines
+	ytdlpArgs = append([]string{"--newline"}, ytdlpArgs...)
+
+	// Chapter files would otherwise land in the working directory, -o's folder only applies to the main file
+	if HasArg(ytdlpArgs, "--split-chapters") && !hasChapterTemplate(ytdlpArgs) {
+		ytdlpArgs = append(ytdlpArgs, "-o", "chapter:"+filepath.Join(downloadsDir, chapterOutputTemplate))
+	}
+
+	return DownloadOptions{
+		URL:               url,
+		OutputPath:        filepath.Join(downloadsDir, OutputTemplate),
+		Format:            format,
+		ExtraArgs:         ytdlpArgs,
+		RestrictFilenames: RestrictFilenames,
+	}
 }
 
-func ensureDownloadsFolder() (string, error) {
+// DryRunDownload prints the yt-dlp command a download of url would run. Nothing is
+// downloaded and the database isn't touched
+func DryRunDownload(url string, ytdlpArgs []string) error {
 	baseDir, err := os.Getwd()
 	if err != nil {
-		return "", err
+		return err
 	}
 	downloadsDir := filepath.Join(baseDir, "downloads")
 
-	if err := os.MkdirAll(downloadsDir, 0755); err != nil {
-		return "", err
+	// yt-dlp would download every result of a multi-result search, a real download only gets the top one
+	if query, ok := SearchQuery(url); ok {
+		url = "ytsearch1:" + query
 	}
 
-	return downloadsDir, nil
+	// The channel folder needs the video's metadata, which is only read
+	if OrganizeByChannel {
+		videoInfo, err := ExtractVideoMetadata(url)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to extract metadata: %v\n", err)
+			videoInfo = &VideoInfo{URL: url}
+		}
+		downloadsDir = filepath.Join(downloadsDir, channelFolder(videoInfo))
+	}
+
+	return DownloadWithCallback(downloadOptions(url, "", downloadsDir, ytdlpArgs), nil)
 }
 
-func cleanupPartFiles(downloadsDir string) {
-	entries, err := os.ReadDir(downloadsDir)
+// runDownload runs yt-dlp for an existing download record and updates its status.
+// Partial files are kept on failure or cancellation when keepPartial is set so the download can be resumed
+func runDownload(ctx context.Context, db *DB, downloadID, url, format, downloadsDir string, ytdlpArgs []string, keepPartial bool, out downloadOutput) error {
+	stderrBuf := &lockedBuffer{}
+	opts := downloadOptions(url, format, downloadsDir, ytdlpArgs)
+	opts.Context = ctx
+	opts.Stderr = stderrBuf
+	opts.Silent = out.silent
+
+	// yt-dlp archives a video before post-processing, so it writes to a copy until we know the download completed
+	var archive *stagedArchive
+	if ArchiveOnlyCompleted {
+		staged, args, err := stageArchive(opts.ExtraArgs)
+		if err != nil {
+			out.warnf("failed to stage download archive, yt-dlp will write to it directly: %v\n", err)
+		} else if staged != nil {
+			archive, opts.ExtraArgs = staged, args
+			defer archive.discard()
+		}
+	}
+
+	attrs := []any{"id", downloadID, "url", url}
+	if sort := ArgValue(opts.ExtraArgs, "--format-sort"); sort != "" {
+		attrs = append(attrs, "format_sort", sort)
+	}
+	if container := ArgValue(opts.ExtraArgs, "--merge-output-format"); container != "" {
+		attrs = append(attrs, "container", container)
+	}
+	logger.Info("download started", attrs...)
+
+	reporter := &headlessReporter{db: db, downloadID: downloadID, out: out}
+	err := DownloadWithReporter(opts, reporter)
+	finalPath, destinations := reporter.finalPath, reporter.destinations
+
+	out.infoln()
+
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to read downloads directory: %v\n", err)
-		return
+		if ctx.Err() != nil {
+			out.infoln("Cancelling download...")
+			logger.Warn("download cancelled", "id", downloadID, "url", url)
+			// Clean up this download's .part files, other downloads may share the folder
+			if !keepPartial {
+				cleanupDownloadPartFiles(destinations, out)
+			}
+			if dbErr := db.UpdateDownloadStatus(downloadID, StatusCancelled, "", "Download cancelled by user"); dbErr != nil {
+				out.warnf("failed to update download status: %v\n", dbErr)
+			}
+			return ErrDownloadCancelled
+		}
+
+		logger.Error("download failed", "id", downloadID, "url", url, "error", err, "stderr", stderrBuf.String())
+		// Clean up .part files on failure too, unless they're wanted for resuming
+		if !keepPartial {
+			cleanupDownloadPartFiles(destinations, out)
+		}
+		if dbErr := db.UpdateDownloadStatus(downloadID, StatusFailed, "", err.Error()); dbErr != nil {
+			out.warnf("failed to update download status: %v\n", dbErr)
+		}
+		sendDownloadWebhook(db, downloadID)
+		return fmt.Errorf("download failed: %w", err)
 	}
 
-	cleaned := 0
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	// yt-dlp exits successfully for filtered or archived videos too, only a file on disk means completed
+	skipReason := reporter.skipReason
+	var fileInfo os.FileInfo
+	if skipReason == "" {
+		if finalPath == "" {
+			skipReason = "yt-dlp finished without writing a file"
+		} else if fileInfo, err = os.Stat(finalPath); err != nil {
+			skipReason = fmt.Sprintf("output file not found: %s", finalPath)
+		}
+	}
+	if skipReason != "" {
+		logger.Info("download skipped", "id", downloadID, "url", url, "reason", skipReason)
+		cleanupDownloadPartFiles(destinations, out)
+		if err := db.UpdateDownloadStatus(downloadID, StatusSkipped, "", skipReason); err != nil {
+			out.warnf("failed to update download status: %v\n", err)
+		}
+		sendDownloadWebhook(db, downloadID)
+		out.infof("⊘ Skipped: %s\n", skipReason)
+		return nil
+	}
+
+	if err := db.UpdateDownloadStatus(downloadID, StatusCompleted, finalPath, ""); err != nil {
+		out.warnf("failed to update download status: %v\n", err)
+	}
+	db.UpdateDownloadFileSize(downloadID, fileInfo.Size())
+
+	// The container only applies when yt-dlp merges streams, a single-file format keeps its extension
+	if container := ArgValue(opts.ExtraArgs, "--merge-output-format"); container != "" && !mergedInto(finalPath, container) {
+		out.warnf("saved as %s, no streams were merged into %s\n", filepath.Ext(finalPath), container)
+	}
+
+	if archive != nil {
+		if err := archive.commit(); err != nil {
+			out.warnf("failed to update download archive: %v\n", err)
+		}
+	}
+
+	// The main file stays the record's path and size, chapters are recorded alongside it
+	for _, chapter := range reporter.chapters {
+		var size int64
+		if info, err := os.Stat(chapter); err == nil {
+			size = info.Size()
 		}
+		if err := db.AddDownloadFile(downloadID, chapter, size); err != nil {
+			out.warnf("failed to record chapter file: %v\n", err)
+		}
+	}
 
-		name := entry.Name()
-		if strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".ytdl") || strings.HasSuffix(name, ".temp") {
-			filePath := filepath.Join(downloadsDir, name)
-			if err := os.Remove(filePath); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", name, err)
-			} else {
-				cleaned++
+	if IngestInfoJSON {
+		if path := infoJSONPath(reporter.infoJSON, finalPath); path != "" {
+			if err := ingestInfoJSON(db, downloadID, path); err != nil {
+				out.warnf("failed to ingest info JSON: %v\n", err)
 			}
 		}
 	}
 
-	if cleaned > 0 {
-		fmt.Printf("Cleaned up %d partial file(s)\n", cleaned)
+	sendDownloadWebhook(db, downloadID)
+
+	logger.Info("download completed", "id", downloadID, "url", url, "title", reporter.title)
+	out.infoln("✓ Download completed successfully!")
+	if Quiet && !out.silent {
+		fmt.Println(finalPath)
 	}
+	return nil
 }
 
-func ListDownloads(db *DB) error {
-	downloads, err := db.GetAllDownloads()
+// RunBatch processes every URL listed in a file, one per line. Blank lines and
+// lines starting with # are skipped, and a failing URL doesn't stop the batch
+func RunBatch(path string, ytdlpArgs []string, db *DB, force, metadataOnly bool) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to get downloads: %w", err)
+		return fmt.Errorf("failed to open batch file: %w", err)
 	}
+	defer f.Close()
 
-	if len(downloads) == 0 {
-		fmt.Println("No downloads yet")
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read batch file: %w", err)
+	}
+
+	if len(urls) == 0 {
+		infoln("No URLs in batch file")
 		return nil
 	}
 
-	fmt.Println("Download History:")
-	fmt.Println(strings.Repeat("─", 80))
+	noPlaylist := HasArg(ytdlpArgs, "--no-playlist")
 
-	for _, d := range downloads {
-		var statusIcon string
-		switch d.Status {
-		case StatusCompleted:
-			statusIcon = "✓"
-		case StatusFailed:
-			statusIcon = "✗"
-		case StatusPending:
-			statusIcon = "⏳"
-		case StatusCancelled:
-			statusIcon = "⊘"
+	var succeeded, failed, downloaded int
+	for i, url := range urls {
+		url = SingleVideoURL(url, noPlaylist)
+		infoln(strings.Repeat("═", 80))
+		infof("[%d/%d] %s\n", i+1, len(urls), url)
+		infoln(strings.Repeat("═", 80))
+
+		err := ValidateURL(url)
+		switch {
+		case err != nil:
+			// Invalid URL, reported below
+		case IsPlaylist(url):
+			err = ExtractPlaylistToDB(url, db)
+		case metadataOnly:
+			err = SaveMetadataOnly(url, db)
 		default:
-			statusIcon = "?"
+			// Only finished downloads count towards -max-downloads
+			var completed bool
+			_, completed, err = runHeadless(url, "", ytdlpArgs, db, force)
+			if completed {
+				downloaded++
+			}
 		}
 
-		fmt.Printf("%s [%s] %s\n", statusIcon, d.ID, d.URL)
-		if d.Title != "" {
-			fmt.Printf("   Title: %s\n", d.Title)
+		if errors.Is(err, ErrDownloadCancelled) {
+			infof("\nBatch cancelled after %d/%d URLs\n", i, len(urls))
+			return err
 		}
-		if d.Channel != "" {
-			fmt.Printf("   Channel: %s\n", d.Channel)
-		}
-		if d.PlaylistID != "" {
-			// Get playlist info to show which playlist this came from
-			playlist, err := db.GetPlaylist(d.PlaylistID)
-			if err == nil && playlist != nil {
-				fmt.Printf("   Playlist: %s\n", playlist.Title)
-			}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed++
 		} else {
-			fmt.Printf("   Source: Direct download (orphan)\n")
-		}
-		if d.FilePath != "" {
-			fmt.Printf("   Path: %s\n", d.FilePath)
+			succeeded++
 		}
-		if d.Error != "" {
-			fmt.Printf("   Error: %s\n", d.Error)
+		infoln()
+
+		if maxDownloadsReached(downloaded) && i < len(urls)-1 {
+			infof("Reached -max-downloads (%d), %d URL(s) left for the next run\n", MaxDownloads, len(urls)-i-1)
+			break
 		}
-		fmt.Printf("   Created: %s\n", d.CreatedAt.Format("2006-01-02 15:04:05"))
-		fmt.Println()
 	}
 
+	infoln(strings.Repeat("─", 80))
+	infof("Batch complete: %d succeeded, %d failed\n", succeeded, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d/%d URLs failed", failed, len(urls))
+	}
 	return nil
 }
 
-func ExtractPlaylistToDB(urlStr string, db *DB) error {
+// SaveMetadataOnly records a video's metadata without downloading it
+func SaveMetadataOnly(url string, db *DB) error {
 	if !IsInstalled() {
 		return fmt.Errorf("yt-dlp is not installed")
 	}
 
-	info, err := ExtractPlaylist(urlStr)
+	videoInfo, err := ExtractVideoMetadata(url)
 	if err != nil {
-		return fmt.Errorf("failed to extract videos: %w", err)
+		return fmt.Errorf("failed to extract metadata: %w", err)
 	}
 
-	if len(info.Videos) == 0 {
-		return fmt.Errorf("no videos found")
+	downloadID, err := db.InsertDownload(NormalizeURL(url), videoInfo.Title)
+	if err != nil {
+		return fmt.Errorf("failed to insert download record: %w", err)
 	}
 
-	title := info.Title
-	if title == "" {
-		title = "Unknown Playlist"
+	if videoInfo.Channel != "" {
+		db.UpdateDownloadChannel(downloadID, videoInfo.Channel)
+	}
+	if videoInfo.ChannelURL != "" {
+		db.UpdateDownloadChannelURL(downloadID, videoInfo.ChannelURL)
+	}
+	if err := db.LinkDownloadChannel(downloadID, videoInfo.Channel, videoInfo.ChannelURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save channel: %v\n", err)
+	}
+	if videoInfo.Duration > 0 {
+		db.UpdateDownloadDuration(downloadID, videoInfo.Duration)
+	}
+	if videoInfo.UploadDate != "" {
+		db.UpdateDownloadUploadDate(downloadID, videoInfo.UploadDate)
+	}
+	if videoInfo.ID != "" && IsYouTubeURL(url) {
+		db.UpdateDownloadVideoID(downloadID, videoInfo.ID)
+	}
+	if videoInfo.LiveStatus != "" {
+		db.UpdateDownloadLiveStatus(downloadID, videoInfo.LiveStatus)
 	}
 
-	totalVideos := len(info.Videos)
-	channel := info.Channel
-	channelURL := info.ChannelURL
-
-	// Check if playlist already exists
-	existingPlaylist, err := db.GetPlaylistByURL(urlStr)
-	var playlistID string
-	var newVideosAdded int
-
-	if err == nil && existingPlaylist != nil {
-		// Playlist exists - update it
-		playlistID = existingPlaylist.ID
-		fmt.Printf("Updating existing playlist: %s\n", title)
-
-		// Add only new videos
-		for i, video := range info.Videos {
-			exists, err := db.VideoExistsInPlaylist(playlistID, video.ID)
-			if err != nil {
-				continue
-			}
-			if !exists {
-				if err := db.InsertPlaylistVideo(playlistID, title, video.URL, video.Title, video.ID, video.Channel, video.ChannelURL, i+1); err == nil {
-					newVideosAdded++
-				}
-			}
-		}
-
-		// Update counts
-		currentSaved := existingPlaylist.VideosSaved + newVideosAdded
-		db.UpdatePlaylistCounts(playlistID, totalVideos, currentSaved, existingPlaylist.VideosDownloaded)
-
-		fmt.Printf("Playlist: %s\n", title)
-		fmt.Printf("Total videos in playlist: %d\n", totalVideos)
-		fmt.Printf("New videos added: %d\n", newVideosAdded)
-		fmt.Printf("Total saved: %d\n", currentSaved)
-	} else {
-		// New playlist
-		savedCount := 0
-		for i, video := range info.Videos {
-			if err := db.InsertPlaylistVideo("", title, video.URL, video.Title, video.ID, video.Channel, video.ChannelURL, i+1); err == nil {
-				savedCount++
-			}
-		}
+	if err := db.UpdateDownloadStatus(downloadID, StatusMetadataOnly, "", ""); err != nil {
+		return fmt.Errorf("failed to update download status: %w", err)
+	}
 
-		playlistID, err = db.InsertPlaylist(urlStr, title, channel, channelURL, totalVideos, savedCount)
-		if err != nil {
-			return fmt.Errorf("failed to insert playlist: %w", err)
-		}
+	infof("Saved metadata: %s\n", videoInfo.Title)
+	if videoInfo.Channel != "" {
+		infof("Channel: %s\n", videoInfo.Channel)
+	}
+	return nil
+}
 
-		// Update playlist_id for the videos
-		for _, video := range info.Videos {
-			db.conn.Exec(`UPDATE playlist_videos SET playlist_id = ? WHERE video_id = ? AND playlist_id = ''`, playlistID, video.ID)
-		}
+// ResumeDownloads retries downloads left pending by an interrupted run, and failed ones if
+// includeFailed is set. Partial files are continued rather than restarted, and cancelled
+// downloads are never resumed
+func ResumeDownloads(db *DB, ytdlpArgs []string, includeFailed bool) error {
+	if !IsInstalled() {
+		return fmt.Errorf("yt-dlp is not installed")
+	}
 
-		fmt.Printf("Playlist: %s\n", title)
-		fmt.Printf("Videos in playlist: %d\n", totalVideos)
-		fmt.Printf("Videos saved to database: %d\n", savedCount)
+	statuses := []DownloadStatus{StatusPending}
+	if includeFailed {
+		statuses = append(statuses, StatusFailed)
+	}
 
-		if savedCount < totalVideos {
-			fmt.Fprintf(os.Stderr, "Warning: Only %d/%d videos were saved\n", savedCount, totalVideos)
-		}
+	downloads, err := db.GetDownloadsByStatus(statuses...)
+	if err != nil {
+		return fmt.Errorf("failed to get downloads: %w", err)
 	}
 
-	return nil
+	if len(downloads) == 0 {
+		infoln("Nothing to resume")
+		return nil
+	}
+
+	downloadsDir, err := ensureDownloadsFolder()
+	if err != nil {
+		return fmt.Errorf("failed to create downloads folder: %w", err)
+	}
+
+	ytdlpArgs = append([]string{"--continue"}, ytdlpArgs...)
+
+	var failed int
+	for i, d := range downloads {
+		infof("[%d/%d] Resuming: %s\n", i+1, len(downloads), d.URL)
+
+		if err := db.UpdateDownloadStatus(d.ID, StatusPending, "", ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update download status: %v\n", err)
+		}
+
+		ctx, stop := interruptContext()
+		err := runDownload(ctx, db, d.ID, d.URL, "", downloadsDir, ytdlpArgs, true, downloadOutput{})
+		stop()
+		if err != nil {
+			if errors.Is(err, ErrDownloadCancelled) {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed++
+		}
+		infoln()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d/%d downloads failed to resume", failed, len(downloads))
+	}
+	return nil
+}
+
+// RunDoctor checks the environment and prints a checklist.
+// Returns an error if any critical check fails
+func RunDoctor(dbPath string) error {
+	failed := 0
+	check := func(ok bool, critical bool, label, detail string) {
+		icon := "✓"
+		if !ok {
+			icon = "✗"
+			if critical {
+				failed++
+			}
+		}
+		if detail != "" {
+			label += " (" + detail + ")"
+		}
+		fmt.Printf("%s %s\n", icon, label)
+	}
+
+	fmt.Println("Environment check:")
+	fmt.Println(strings.Repeat("─", 80))
+
+	if IsInstalled() {
+		version, err := GetYtdlpVersion()
+		if err != nil {
+			check(true, true, "yt-dlp installed", "version unknown")
+		} else {
+			check(true, true, "yt-dlp installed", version)
+			if hint := YtdlpUpdateHint(version); hint != "" {
+				fmt.Printf("   %s\n", hint)
+			}
+		}
+	} else {
+		check(false, true, "yt-dlp installed", "not found in PATH")
+	}
+
+	if IsFfmpegInstalled() {
+		check(true, false, "ffmpeg installed", "")
+	} else {
+		check(false, false, "ffmpeg installed", "needed for -x and merging formats")
+	}
+
+	if downloadsDir, err := ensureDownloadsFolder(); err != nil {
+		check(false, true, "downloads folder writable", err.Error())
+	} else if f, err := os.CreateTemp(downloadsDir, ".doctor-*"); err != nil {
+		check(false, true, "downloads folder writable", err.Error())
+	} else {
+		f.Close()
+		os.Remove(f.Name())
+		check(true, true, "downloads folder writable", downloadsDir)
+	}
+
+	if db, err := Open(dbPath); err != nil {
+		check(false, true, "database opens", err.Error())
+	} else {
+		db.Close()
+		check(true, true, "database opens", dbPath)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d critical check(s) failed", failed)
+	}
+	return nil
+}
+
+func ensureDownloadsFolder() (string, error) {
+	baseDir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	downloadsDir := filepath.Join(baseDir, "downloads")
+
+	if err := os.MkdirAll(downloadsDir, 0755); err != nil {
+		return "", err
+	}
+
+	return downloadsDir, nil
+}
+
+// mergedInto checks if path has the extension of the --merge-output-format container,
+// which may list alternatives such as mp4/mkv
+func mergedInto(path, container string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	for _, c := range strings.Split(container, "/") {
+		if strings.ToLower(c) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// partFileRegex matches the leftovers of unfinished yt-dlp downloads
+var partFileRegex = regexp.MustCompile(`\.(part|ytdl|temp)$|\.part-Frag\d+(\.part)?$`)
+
+// activePartFileAge is how recently a partial file must have been written to be
+// treated as belonging to a running download
+const activePartFileAge = 10 * time.Minute
+
+// CleanupPartFiles removes the partial files unfinished downloads left anywhere under
+// downloadsDir, or only lists them when dryRun is set. Recently written files are kept
+// since they may belong to a download running in another process, e.g. the server
+func CleanupPartFiles(downloadsDir string, dryRun bool) error {
+	var removed, kept int
+	var freed int64
+	err := filepath.WalkDir(downloadsDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read %s: %v\n", path, err)
+			return nil
+		}
+		if entry.IsDir() || !partFileRegex.MatchString(entry.Name()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if time.Since(info.ModTime()) < activePartFileAge {
+			kept++
+			return nil
+		}
+
+		if dryRun {
+			fmt.Printf("Would remove %s (%s)\n", path, formatBytes(info.Size()))
+		} else if err := os.Remove(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", path, err)
+			return nil
+		} else {
+			infof("Removed %s (%s)\n", path, formatBytes(info.Size()))
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", downloadsDir, err)
+	}
+
+	if dryRun {
+		fmt.Printf("Would remove %d partial file(s), freeing %s\n", removed, formatBytes(freed))
+	} else {
+		fmt.Printf("Removed %d partial file(s), freed %s\n", removed, formatBytes(freed))
+	}
+	if kept > 0 {
+		fmt.Printf("Kept %d file(s) written in the last %s, they may belong to a running download\n", kept, activePartFileAge)
+	}
+	return nil
+}
+
+// cleanupDownloadPartFiles removes the partial files yt-dlp left next to the given destinations,
+// leaving the partial files of other downloads alone
+func cleanupDownloadPartFiles(destinations []string, out downloadOutput) {
+	cleaned := 0
+	for _, dest := range destinations {
+		dir, base := filepath.Split(dest)
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			out.warnf("failed to read downloads directory: %v\n", err)
+			continue
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasPrefix(name, base) {
+				continue
+			}
+			suffix := strings.TrimPrefix(name, base)
+			if suffix == ".part" || suffix == ".ytdl" || suffix == ".temp" || strings.HasPrefix(suffix, ".part-Frag") {
+				if err := os.Remove(filepath.Join(dir, name)); err != nil {
+					out.warnf("failed to remove %s: %v\n", name, err)
+				} else {
+					cleaned++
+				}
+			}
+		}
+	}
+
+	if cleaned > 0 {
+		out.infof("Cleaned up %d partial file(s)\n", cleaned)
+	}
+}
+
+// ListDownloads prints the download history, limited to [since, until) when either is set
+func ListDownloads(db *DB, since, until time.Time) error {
+	downloads, err := db.GetDownloadsWithPlaylistBetween(since, until)
+	if err != nil {
+		return fmt.Errorf("failed to get downloads: %w", err)
+	}
+
+	if len(downloads) == 0 {
+		if !since.IsZero() || !until.IsZero() {
+			fmt.Println("No downloads in that time window")
+		} else {
+			fmt.Println("No downloads yet")
+		}
+		return nil
+	}
+
+	// Counted once up front rather than queried per download
+	chapterFiles, err := db.CountDownloadFiles()
+	if err != nil {
+		return fmt.Errorf("failed to count chapter files: %w", err)
+	}
+
+	fmt.Println("Download History:")
+	fmt.Println(strings.Repeat("─", 80))
+
+	for _, d := range downloads {
+		printDownload(d.DownloadRecord, d.PlaylistTitle.String, chapterFiles[d.ID])
+	}
+
+	return nil
+}
+
+// ListDownloadsJSON prints the download history as a JSON array, each download with its
+// playlistTitle, limited to [since, until) when either is set
+func ListDownloadsJSON(db *DB, since, until time.Time) error {
+	downloads, err := db.GetDownloadsWithPlaylistBetween(since, until)
+	if err != nil {
+		return fmt.Errorf("failed to get downloads: %w", err)
+	}
+	if downloads == nil {
+		downloads = []DownloadWithPlaylist{}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(downloads)
+}
+
+// ExportDownloadsCSV writes the download history to a CSV file
+func ExportDownloadsCSV(db *DB, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if err := db.ExportDownloadsCSV(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to export downloads: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	fmt.Printf("Exported download history to %s\n", path)
+	return nil
+}
+
+// ImportPlaylists seeds the database with the playlists listed in a JSON or CSV file.
+// See DB.ImportPlaylists for the accepted formats
+func ImportPlaylists(db *DB, path string) error {
+	if !IsInstalled() {
+		return fmt.Errorf("yt-dlp is not installed")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer f.Close()
+
+	return db.ImportPlaylists(f)
+}
+
+// ImportPlaylists fetches and saves the playlists listed in r, skipping playlists already
+// in the database. r holds either a JSON array of URLs or of objects with a "url" field, or
+// CSV with a "url" column (or a single column of URLs)
+func (db *DB) ImportPlaylists(r io.Reader) error {
+	urls, err := readPlaylistURLs(r)
+	if err != nil {
+		return err
+	}
+
+	// A failing playlist doesn't stop the import, all failures are returned together
+	var imported, skipped int
+	var failures []error
+	for i, u := range urls {
+		// Normalized so different forms of the same playlist URL are only saved once
+		u = NormalizeURL(u)
+		infof("[%d/%d] %s\n", i+1, len(urls), u)
+
+		if existing, err := db.GetPlaylistByURL(u); err == nil && existing != nil {
+			infoln("Already saved, skipping")
+			skipped++
+			continue
+		}
+
+		if err := ExtractPlaylistToDB(u, db); err != nil {
+			infof("Failed: %v\n", err)
+			failures = append(failures, fmt.Errorf("%s: %w", u, err))
+			continue
+		}
+		imported++
+	}
+
+	infoln(strings.Repeat("─", 80))
+	infof("Import complete: %d imported, %d skipped, %d failed\n", imported, skipped, len(failures))
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d playlists failed to import:\n%w", len(failures), len(urls), errors.Join(failures...))
+	}
+	return nil
+}
+
+// readPlaylistURLs parses the JSON or CSV import formats accepted by DB.ImportPlaylists
+func readPlaylistURLs(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var entries []json.RawMessage
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		for _, entry := range entries {
+			var u string
+			if err := json.Unmarshal(entry, &u); err != nil {
+				var record struct {
+					URL string `json:"url"`
+				}
+				if err := json.Unmarshal(entry, &record); err != nil {
+					return nil, fmt.Errorf("invalid playlist entry %s", entry)
+				}
+				u = record.URL
+			}
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
+			}
+		}
+		return urls, nil
+	}
+
+	cr := csv.NewReader(bytes.NewReader(trimmed))
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	column := 0
+	if len(records) > 0 {
+		for i, name := range records[0] {
+			if strings.EqualFold(strings.TrimSpace(name), "url") {
+				column = i
+				records = records[1:]
+				break
+			}
+		}
+	}
+	for _, record := range records {
+		if column < len(record) {
+			if u := strings.TrimSpace(record[column]); u != "" {
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls, nil
+}
+
+var statsBoxStyle = lipgloss.NewStyle().
+	Border(lipgloss.RoundedBorder()).
+	BorderForeground(lipgloss.Color("#fc40fc")).
+	Padding(0, 2)
+
+// PrintStats prints an overview of the download history
+func PrintStats(db *DB) error {
+	stats, err := db.GetStats()
+	if err != nil {
+		return fmt.Errorf("failed to get stats: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.UnsetMarginBottom().Render("Download Stats"))
+	b.WriteString("\n\n")
+	fmt.Fprintf(&b, "Total downloads:  %d\n", stats.TotalDownloads)
+	for _, status := range []DownloadStatus{StatusCompleted, StatusFailed, StatusPending, StatusCancelled, StatusMetadataOnly, StatusSkipped} {
+		fmt.Fprintf(&b, "  %-15s %d\n", string(status)+":", stats.ByStatus[status])
+	}
+	fmt.Fprintf(&b, "Downloaded size:  %s\n", formatBytes(stats.TotalBytes))
+	fmt.Fprintf(&b, "Playlists:        %d\n", stats.Playlists)
+	fmt.Fprintf(&b, "Videos pending:   %d", stats.PendingVideos)
+
+	fmt.Println(statsBoxStyle.Render(b.String()))
+	return nil
+}
+
+// formatDuration renders seconds as HH:MM:SS
+func formatDuration(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// formatUploadDate renders yt-dlp's YYYYMMDD upload date as YYYY-MM-DD
+func formatUploadDate(date string) string {
+	t, err := time.Parse("20060102", date)
+	if err != nil {
+		return date
+	}
+	return t.Format("2006-01-02")
+}
+
+// formatBytes renders a byte count with a binary unit suffix
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// PurgeDownloads deletes the download records with the given statuses, only those older
+// than olderThan when it's non-zero, and prints how many were removed
+func PurgeDownloads(db *DB, statuses []DownloadStatus, olderThan time.Duration) error {
+	var cutoff time.Time
+	if olderThan > 0 {
+		cutoff = time.Now().Add(-olderThan)
+	}
+
+	for _, status := range statuses {
+		n, err := db.PurgeByStatusBefore(status, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to purge %s downloads: %w", status, err)
+		}
+		if cutoff.IsZero() {
+			fmt.Printf("Purged %d %s download(s)\n", n, status)
+		} else {
+			fmt.Printf("Purged %d %s download(s) created before %s\n", n, status, cutoff.Format("2006-01-02 15:04"))
+		}
+	}
+	return nil
+}
+
+// ListOrphanDownloads prints direct downloads that don't belong to any playlist
+func ListOrphanDownloads(db *DB) error {
+	downloads, err := db.GetOrphanDownloads()
+	if err != nil {
+		return fmt.Errorf("failed to get orphan downloads: %w", err)
+	}
+
+	if len(downloads) == 0 {
+		fmt.Println("No orphan downloads")
+		return nil
+	}
+
+	chapterFiles, err := db.CountDownloadFiles()
+	if err != nil {
+		return fmt.Errorf("failed to count chapter files: %w", err)
+	}
+
+	fmt.Println("Orphan Downloads:")
+	fmt.Println(strings.Repeat("─", 80))
+
+	for _, d := range downloads {
+		printDownload(d, "", chapterFiles[d.ID])
+	}
+
+	return nil
+}
+
+// ListChannels prints every channel downloads or playlists were saved from
+func ListChannels(db *DB) error {
+	channels, err := db.GetChannels()
+	if err != nil {
+		return fmt.Errorf("failed to get channels: %w", err)
+	}
+
+	if len(channels) == 0 {
+		fmt.Println("No channels yet")
+		return nil
+	}
+
+	fmt.Println("Channels:")
+	fmt.Println(strings.Repeat("─", 80))
+
+	for _, c := range channels {
+		fmt.Printf("📺 [%s] %s\n", c.ID, c.Name)
+		fmt.Printf("   URL: %s\n", c.URL)
+		fmt.Printf("   Downloads: %d\n", c.Downloads)
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// ListChannelDownloads prints the downloads of one channel
+func ListChannelDownloads(db *DB, channelID string) error {
+	channel, err := db.GetChannel(channelID)
+	if err != nil {
+		return fmt.Errorf("channel %s not found: %w", channelID, err)
+	}
+
+	downloads, err := db.GetDownloadsByChannel(channel.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get downloads: %w", err)
+	}
+
+	if len(downloads) == 0 {
+		fmt.Printf("No downloads from %s\n", channel.Name)
+		return nil
+	}
+
+	playlists, err := db.GetAllPlaylists()
+	if err != nil {
+		return fmt.Errorf("failed to get playlists: %w", err)
+	}
+	titles := make(map[string]string, len(playlists))
+	for _, p := range playlists {
+		titles[p.ID] = p.Title
+	}
+	chapterFiles, err := db.CountDownloadFiles()
+	if err != nil {
+		return fmt.Errorf("failed to count chapter files: %w", err)
+	}
+
+	fmt.Printf("Downloads from %s:\n", channel.Name)
+	fmt.Println(strings.Repeat("─", 80))
+
+	for _, d := range downloads {
+		printDownload(d, titles[d.PlaylistID], chapterFiles[d.ID])
+	}
+
+	return nil
+}
+
+// statusIcon returns the symbol shown next to a download with the given status
+func statusIcon(status DownloadStatus) string {
+	switch status {
+	case StatusCompleted:
+		return "✓"
+	case StatusFailed:
+		return "✗"
+	case StatusPending:
+		return "⏳"
+	case StatusCancelled:
+		return "⊘"
+	case StatusMetadataOnly:
+		return "ℹ"
+	case StatusSkipped:
+		return "↷"
+	}
+	return "?"
+}
+
+// liveStatusLabel describes a live status for the history, "" for regular videos
+func liveStatusLabel(status string) string {
+	switch status {
+	case liveStatusLive:
+		return "live stream"
+	case liveStatusWasLive, liveStatusPostLive:
+		return "recorded live stream"
+	case liveStatusUpcoming:
+		return "scheduled stream or premiere"
+	}
+	return ""
+}
+
+// printDownload prints one entry of a download listing. playlistTitle and chapterFiles are
+// looked up by the caller for the whole listing at once
+func printDownload(d DownloadRecord, playlistTitle string, chapterFiles int) {
+	fmt.Printf("%s [%s] %s\n", statusIcon(d.Status), d.ID, d.URL)
+	if d.Title != "" {
+		fmt.Printf("   Title: %s\n", d.Title)
+	}
+	if d.Channel != "" {
+		fmt.Printf("   Channel: %s\n", d.Channel)
+	}
+	if d.Duration > 0 {
+		fmt.Printf("   Duration: %s\n", formatDuration(d.Duration))
+	}
+	if d.UploadDate != "" {
+		fmt.Printf("   Uploaded: %s\n", formatUploadDate(d.UploadDate))
+	}
+	if label := liveStatusLabel(d.LiveStatus); label != "" {
+		fmt.Printf("   Live: %s\n", label)
+	}
+	if d.PlaylistID != "" {
+		if playlistTitle != "" {
+			fmt.Printf("   Playlist: %s\n", playlistTitle)
+		}
+	} else {
+		fmt.Printf("   Source: Direct download (orphan)\n")
+	}
+	if d.FilePath != "" {
+		fmt.Printf("   Path: %s\n", d.FilePath)
+	}
+	if chapterFiles > 0 {
+		fmt.Printf("   Chapter files: %d\n", chapterFiles)
+	}
+	if d.Error != "" {
+		fmt.Printf("   Error: %s\n", strings.ReplaceAll(d.Error, "\n", "\n          "))
+	}
+	fmt.Printf("   Created: %s\n", d.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Println()
+}
+
+func ExtractPlaylistToDB(urlStr string, db *DB) error {
+	return ExtractPlaylistItemsToDB(urlStr, "", db)
+}
+
+// ExtractPlaylistItemsToDB saves only the playlist entries selected by a --playlist-items spec
+func ExtractPlaylistItemsToDB(urlStr, items string, db *DB) error {
+	if !IsInstalled() {
+		return fmt.Errorf("yt-dlp is not installed")
+	}
+
+	info, err := ExtractPlaylistItems(urlStr, items)
+	if err != nil {
+		return fmt.Errorf("failed to extract videos: %w", err)
+	}
+
+	if len(info.Videos) == 0 {
+		return fmt.Errorf("no videos found")
+	}
+
+	if needsConfirmation(db, urlStr, info) && !AssumeYes {
+		if !confirm(fmt.Sprintf("This playlist has %s videos. Save all?", formatThousands(len(info.Videos)))) {
+			return ErrNotConfirmed
+		}
+	}
+
+	return savePlaylistInfo(db, urlStr, info)
+}
+
+// LargePlaylistThreshold is the number of videos above which saving a new playlist asks
+// for confirmation first. AssumeYes answers yes without asking
+var (
+	LargePlaylistThreshold = 500
+	AssumeYes              bool
+)
+
+// ErrNotConfirmed is returned when saving a large playlist wasn't confirmed
+var ErrNotConfirmed = errors.New("playlist not saved, use -yes to save large playlists without asking")
+
+// needsConfirmation checks if info is a new playlist large enough to ask before saving it
+func needsConfirmation(db *DB, urlStr string, info *PlaylistInfo) bool {
+	if len(info.Videos) <= LargePlaylistThreshold {
+		return false
+	}
+	existing, err := db.GetPlaylistByURL(urlStr)
+	return err != nil || existing == nil
+}
+
+// stdin is shared by every prompt so buffered answers aren't lost between them
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirm asks a yes/no question on the terminal. Anything but y or yes, including no input, is no
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	line, _ := stdin.ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
+// formatThousands renders n with comma thousands separators, e.g. 1,240
+func formatThousands(n int) string {
+	digits := strconv.Itoa(n)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return b.String()
+}
+
+// savePlaylistInfo saves an extracted playlist and its videos, or adds the new videos
+// when the playlist is already saved
+func savePlaylistInfo(db *DB, urlStr string, info *PlaylistInfo) error {
+	title := info.Title
+	if title == "" {
+		title = "Unknown Playlist"
+	}
+
+	totalVideos := len(info.Videos)
+	channel := info.Channel
+	channelURL := info.ChannelURL
+
+	// Check if playlist already exists
+	existingPlaylist, err := db.GetPlaylistByURL(urlStr)
+	if err == nil && existingPlaylist != nil {
+		// Playlist exists - add only new videos
+		infof("Updating existing playlist: %s\n", title)
+
+		added, err := db.AddPlaylistVideos(existingPlaylist.ID, info.Videos, totalVideos)
+		if err != nil {
+			return fmt.Errorf("failed to save new videos: %w", err)
+		}
+
+		infof("Playlist: %s\n", title)
+		infof("Total videos in playlist: %d\n", totalVideos)
+		infof("New videos added: %d\n", len(added))
+		if saved, err := db.CountPlaylistVideos(existingPlaylist.ID); err == nil {
+			infof("Total saved: %d\n", saved)
+		}
+	} else {
+		// New playlist - saved with all its videos, or not at all
+		_, saved, err := db.SaveNewPlaylist(urlStr, title, channel, channelURL, info.Videos)
+		if err != nil {
+			return fmt.Errorf("failed to save playlist: %w", err)
+		}
+
+		infof("Playlist: %s\n", title)
+		infof("Videos in playlist: %d\n", totalVideos)
+		infof("Videos saved to database: %d\n", saved)
+	}
+
+	return nil
+}
+
+// SyncPlaylist re-extracts a saved playlist and downloads only the videos added since the last sync
+func SyncPlaylist(db *DB, playlistID string, ytdlpArgs []string) error {
+	if !IsInstalled() {
+		return fmt.Errorf("yt-dlp is not installed")
+	}
+
+	playlist, err := db.GetPlaylist(playlistID)
+	if err != nil {
+		return fmt.Errorf("playlist %s not found: %w", playlistID, err)
+	}
+
+	infof("Syncing playlist: %s\n", playlist.Title)
+
+	info, err := ExtractPlaylist(playlist.URL)
+	if err != nil {
+		return fmt.Errorf("failed to extract videos: %w", err)
+	}
+
+	// Playlists get renamed, keep what's stored current. An empty value means yt-dlp didn't report it
+	title, channel, channelURL := playlist.Title, playlist.Channel, playlist.ChannelURL
+	if info.Title != "" {
+		title = info.Title
+	}
+	if info.Channel != "" {
+		channel, channelURL = info.Channel, info.ChannelURL
+	}
+	if title != playlist.Title || channel != playlist.Channel || channelURL != playlist.ChannelURL {
+		if err := db.UpdatePlaylistMetadata(playlist.ID, title, channel, channelURL); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update playlist metadata: %v\n", err)
+		} else {
+			if title != playlist.Title {
+				infof("Playlist renamed: %s -> %s\n", playlist.Title, title)
+			}
+			playlist.Title, playlist.Channel, playlist.ChannelURL = title, channel, channelURL
+		}
+	}
+
+	totalVideos := len(info.Videos)
+	newVideos, err := db.AddPlaylistVideos(playlist.ID, info.Videos, totalVideos)
+	if err != nil {
+		return fmt.Errorf("failed to save new videos: %w", err)
+	}
+	videosSaved, err := db.CountPlaylistVideos(playlist.ID)
+	if err != nil {
+		videosSaved = playlist.VideosSaved + len(newVideos)
+	}
+
+	if len(newVideos) == 0 {
+		infoln("No new videos")
+		return nil
+	}
+
+	infof("New videos: %d\n\n", len(newVideos))
+
+	return downloadPlaylistVideos(db, playlist, downloadOrder(newVideos), totalVideos, videosSaved, ytdlpArgs)
+}
+
+// DownloadPlaylist downloads every saved video of a playlist that hasn't been downloaded yet
+func DownloadPlaylist(db *DB, playlistID string, ytdlpArgs []string) error {
+	return downloadPlaylist(db, playlistID, ytdlpArgs, false)
+}
+
+// ResumePlaylist continues an interrupted playlist download from its first video that isn't
+// downloaded yet. A video that was cut off continues from its partial file
+func ResumePlaylist(db *DB, playlistID string, ytdlpArgs []string) error {
+	if !HasArg(ytdlpArgs, "--no-continue") {
+		ytdlpArgs = append([]string{"--continue"}, ytdlpArgs...)
+	}
+	return downloadPlaylist(db, playlistID, ytdlpArgs, true)
+}
+
+// downloadPlaylist downloads the saved videos of a playlist that aren't downloaded yet, in playlist
+// order or reversed with PlaylistReverse
+func downloadPlaylist(db *DB, playlistID string, ytdlpArgs []string, resume bool) error {
+	if !IsInstalled() {
+		return fmt.Errorf("yt-dlp is not installed")
+	}
+
+	playlist, err := db.GetPlaylist(playlistID)
+	if err != nil {
+		return fmt.Errorf("playlist %s not found: %w", playlistID, err)
+	}
+
+	videos, err := db.GetPlaylistVideos(playlist.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get playlist videos: %w", err)
+	}
+
+	var pending []VideoInfo
+	for _, v := range videos {
+		if v.Downloaded {
+			continue
+		}
+		pending = append(pending, VideoInfo{
+			URL:        v.VideoURL,
+			Title:      v.VideoTitle,
+			ID:         v.VideoID,
+			Channel:    v.Channel,
+			ChannelURL: v.ChannelURL,
+			Index:      v.Index,
+		})
+	}
+
+	pending = downloadOrder(pending)
+
+	infof("Downloading playlist: %s\n", playlist.Title)
+	if len(pending) == 0 {
+		// They may have been downloaded through another playlist, which this one's count missed
+		updatePlaylistDownloaded(db, playlist.ID, playlist.TotalVideos, playlist.VideosSaved, playlist.VideosDownloaded)
+		infoln("All videos are already downloaded")
+		return nil
+	}
+	if resume {
+		infof("Resuming at #%d: %s\n", pending[0].Index, pending[0].Title)
+	}
+	infof("Videos to download: %d of %d\n\n", len(pending), len(videos))
+
+	return downloadPlaylistVideos(db, playlist, pending, playlist.TotalVideos, playlist.VideosSaved, ytdlpArgs)
+}
+
+// PlaylistReverse downloads playlist videos last to first, e.g. oldest first for a channel.
+// Only the download order changes, saved videos keep their playlist index
+var PlaylistReverse bool
+
+// downloadOrder returns videos in the order they should be downloaded
+func downloadOrder(videos []VideoInfo) []VideoInfo {
+	if !PlaylistReverse {
+		return videos
+	}
+	reversed := make([]VideoInfo, len(videos))
+	for i, v := range videos {
+		reversed[len(videos)-1-i] = v
+	}
+	return reversed
+}
+
+// MaxDownloads caps how many videos a playlist or batch run downloads, 0 means no limit.
+// It's enforced here rather than with yt-dlp's --max-downloads since each video is its own yt-dlp run
+var MaxDownloads int
+
+// maxDownloadsReached checks if a run that has downloaded n videos should stop
+func maxDownloadsReached(n int) bool {
+	return MaxDownloads > 0 && n >= MaxDownloads
+}
+
+// updatePlaylistDownloaded recounts a playlist's downloaded videos and saves the count. Marking a
+// video downloaded marks it in every playlist that has it, so counting up from the cached value
+// would drift. Returns the new count, or current if it couldn't be updated
+func updatePlaylistDownloaded(db *DB, playlistID string, totalVideos, videosSaved, current int) int {
+	downloaded, err := db.CountDownloadedPlaylistVideos(playlistID)
+	if err == nil {
+		err = db.UpdatePlaylistCounts(playlistID, totalVideos, videosSaved, downloaded)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update playlist counts: %v\n", err)
+		return current
+	}
+	return downloaded
+}
+
+// downloadPlaylistVideos downloads videos of a playlist one at a time, showing the overall
+// position and the time left estimated from the average time per video so far.
+// The playlist's downloaded count is saved after every video so it survives restarts
+func downloadPlaylistVideos(db *DB, playlist *PlaylistRecord, videos []VideoInfo, totalVideos, videosSaved int, ytdlpArgs []string) error {
+	videosDownloaded := playlist.VideosDownloaded
+
+	start := time.Now()
+	var attempted, failed, skipped int
+	for i, video := range videos {
+		header := fmt.Sprintf("[%d/%d] %s", i+1, len(videos), video.Title)
+		if attempted > 0 {
+			perVideo := time.Since(start) / time.Duration(attempted)
+			left := perVideo * time.Duration(len(videos)-i)
+			header += fmt.Sprintf(" (playlist ETA %s)", formatDuration(int(left.Seconds())))
+		}
+		infoln(header)
+
+		existing, err := db.GetCompletedDownloadByURL(video.URL)
+		if err == nil && existing != nil {
+			infoln("Already downloaded, skipping")
+			if err := db.MarkPlaylistVideoDownloaded(video.ID, existing.ID); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to mark video as downloaded: %v\n", err)
+				continue
+			}
+			videosDownloaded = updatePlaylistDownloaded(db, playlist.ID, totalVideos, videosSaved, videosDownloaded)
+			continue
+		}
+
+		attempted++
+		downloadID, err := downloadVideo(video.URL, "", ytdlpArgs, db, playlist.ID)
+		if err != nil {
+			if errors.Is(err, ErrDownloadCancelled) {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed++
+			continue
+		}
+
+		// Filtered-out videos stay unmarked so a later run without the filter still gets them
+		if d, err := db.GetDownload(downloadID); err == nil && d.Status == StatusSkipped {
+			skipped++
+			continue
+		}
+
+		if err := db.MarkPlaylistVideoDownloaded(video.ID, downloadID); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to mark video as downloaded: %v\n", err)
+		}
+
+		videosDownloaded = updatePlaylistDownloaded(db, playlist.ID, totalVideos, videosSaved, videosDownloaded)
+
+		// The rest stay pending for the next run. Videos downloaded earlier don't count
+		if maxDownloadsReached(attempted-failed-skipped) && i < len(videos)-1 {
+			infof("Reached -max-downloads (%d), %d video(s) left for the next run\n", MaxDownloads, len(videos)-i-1)
+			break
+		}
+	}
+
+	infof("Playlist progress: %d/%d videos downloaded in %s\n", videosDownloaded, totalVideos, formatDuration(int(time.Since(start).Seconds())))
+	if skipped > 0 {
+		infof("%d video(s) skipped by filters\n", skipped)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d/%d videos failed to download", failed, len(videos))
+	}
+	return nil
+}
+
+// SyncAllPlaylists syncs every saved playlist, continuing past individual failures
+func SyncAllPlaylists(db *DB, ytdlpArgs []string) error {
+	playlists, err := db.GetAllPlaylists()
+	if err != nil {
+		return fmt.Errorf("failed to get playlists: %w", err)
+	}
+
+	if len(playlists) == 0 {
+		infoln("No playlists yet")
+		return nil
+	}
+
+	var failed int
+	for _, p := range playlists {
+		if err := SyncPlaylist(db, p.ID, ytdlpArgs); err != nil {
+			if errors.Is(err, ErrDownloadCancelled) {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Error syncing %s: %v\n", p.Title, err)
+			failed++
+		}
+		infoln()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d/%d playlists failed to sync", failed, len(playlists))
+	}
+	return nil
+}
+
+// DeletePlaylist removes a saved playlist and its videos. Downloaded files and their
+// download records are kept as orphan downloads
+func DeletePlaylist(db *DB, id string) error {
+	playlist, err := db.GetPlaylist(id)
+	if err != nil {
+		return fmt.Errorf("playlist %s not found: %w", id, err)
+	}
+
+	if err := db.DeletePlaylist(id); err != nil {
+		return fmt.Errorf("failed to delete playlist: %w", err)
+	}
+
+	fmt.Printf("Deleted playlist: %s\n", playlist.Title)
+	return nil
+}
+
+// countsBatchSize is how many videos are looked up per yt-dlp call when fetching view counts
+const countsBatchSize = 50
+
+// ListPopularVideos prints the videos of a playlist by view count. Flat playlist extraction
+// often leaves the counts out, so missing ones are fetched per video first
+func ListPopularVideos(db *DB, playlistID string) error {
+	playlist, err := db.GetPlaylist(playlistID)
+	if err != nil {
+		return fmt.Errorf("playlist not found: %s", playlistID)
+	}
+
+	videos, err := db.GetPlaylistVideos(playlistID)
+	if err != nil {
+		return fmt.Errorf("failed to get playlist videos: %w", err)
+	}
+
+	var missing []PlaylistVideo
+	for _, v := range videos {
+		if v.ViewCount == nil {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) > 0 {
+		if !IsInstalled() {
+			return fmt.Errorf("yt-dlp is not installed")
+		}
+		infof("Fetching view counts for %d video(s)...\n", len(missing))
+		fetchPlaylistVideoCounts(db, playlistID, missing)
+	}
+
+	videos, err = db.GetPlaylistVideosSortedByViews(playlistID)
+	if err != nil {
+		return fmt.Errorf("failed to get playlist videos: %w", err)
+	}
+
+	fmt.Printf("Most viewed in %s:\n", playlist.Title)
+	fmt.Println(strings.Repeat("─", 80))
+	for i, v := range videos {
+		fmt.Printf("%3d. %s\n", i+1, v.VideoTitle)
+		fmt.Printf("     Views: %s | Likes: %s | %s\n", formatCount(v.ViewCount), formatCount(v.LikeCount), v.VideoURL)
+	}
+
+	return nil
+}
+
+// fetchPlaylistVideoCounts looks up and stores the view and like counts of the given videos
+func fetchPlaylistVideoCounts(db *DB, playlistID string, videos []PlaylistVideo) {
+	for start := 0; start < len(videos); start += countsBatchSize {
+		end := min(start+countsBatchSize, len(videos))
+		batch := videos[start:end]
+
+		urls := make([]string, len(batch))
+		for i, v := range batch {
+			urls[i] = v.VideoURL
+		}
+
+		infos, err := ExtractVideoMetadataBatch(urls)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to fetch view counts: %v\n", err)
+			continue
+		}
+		for i, info := range infos {
+			if info == nil || (info.ViewCount == nil && info.LikeCount == nil) {
+				continue
+			}
+			if err := db.UpdatePlaylistVideoCounts(playlistID, batch[i].VideoID, info.ViewCount, info.LikeCount); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save view counts for %s: %v\n", batch[i].VideoID, err)
+			}
+		}
+	}
+}
+
+// formatCount renders a view or like count, or "—" when unknown
+func formatCount(n *int64) string {
+	if n == nil {
+		return "—"
+	}
+	return fmt.Sprintf("%d", *n)
 }
 
 func ListPlaylists(db *DB) error {
@@ -0,0 +1,324 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Interrupting a download must cancel it, clean up its partial file and stop listening for
+// signals. Run with -race: the signal handling and the download run on different goroutines
+func TestDownloadVideoInterrupt(t *testing.T) {
+	t.Chdir(t.TempDir())
+	quiet(t)
+	db := newTestDB(t)
+
+	started := make(chan struct{})
+	useRunner(t, &fakeRunner{
+		run: func(args []string) (string, string, error) {
+			return fakeVideoJSON, "", nil
+		},
+		stream: func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+			path, _ := filepath.Abs(filepath.Join("downloads", "video.mp4"))
+			if err := os.WriteFile(path+".part", []byte("partial"), 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "[download] Destination: %s\n", path)
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	// A second download checks the first one's signal handling didn't linger
+	for i := range 2 {
+		done := make(chan struct{})
+		var id string
+		var err error
+		go func() {
+			defer close(done)
+			id, err = downloadVideo("https://www.youtube.com/watch?v=dQw4w9WgXcQ", "", nil, db, "")
+		}()
+
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("download never started")
+		}
+		if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+			t.Fatalf("failed to interrupt: %v", err)
+		}
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("download wasn't cancelled")
+		}
+
+		if !errors.Is(err, ErrDownloadCancelled) {
+			t.Errorf("download %d: error = %v, want ErrDownloadCancelled", i, err)
+		}
+		if d, dbErr := db.GetDownload(id); dbErr != nil || d.Status != StatusCancelled {
+			t.Errorf("download %d: record = %+v, %v, want cancelled", i, d, dbErr)
+		}
+		if _, statErr := os.Stat(filepath.Join("downloads", "video.mp4.part")); !os.IsNotExist(statErr) {
+			t.Errorf("download %d: partial file wasn't removed: %v", i, statErr)
+		}
+	}
+}
+
+// captureOutput returns what f prints to stdout and stderr
+func captureOutput(t *testing.T, f func()) (stdout, stderr string) {
+	t.Helper()
+	capture := func(file **os.File) func() string {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := *file
+		*file = w
+		out := make(chan string)
+		go func() {
+			b, _ := io.ReadAll(r)
+			out <- string(b)
+		}()
+		return func() string {
+			*file = old
+			w.Close()
+			return <-out
+		}
+	}
+
+	stopStdout, stopStderr := capture(&os.Stdout), capture(&os.Stderr)
+	// Deferred so the real stdout and stderr come back even if f fails the test
+	defer func() { stdout, stderr = stopStdout(), stopStderr() }()
+	f()
+	return
+}
+
+func TestDryRunDownload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	old := DryRun
+	DryRun = true
+	t.Cleanup(func() { DryRun = old })
+	runner := &fakeRunner{}
+	useRunner(t, runner)
+
+	var err error
+	out, _ := captureOutput(t, func() {
+		err = DryRunDownload("ytsearch5:rick astley", []string{"--password", "hunter2", "--embed-metadata"})
+	})
+	if err != nil {
+		t.Fatalf("DryRunDownload: %v", err)
+	}
+
+	out = strings.TrimSuffix(out, "\n")
+	if !strings.HasPrefix(out, "yt-dlp ") || !strings.Contains(out, " --newline ") || strings.Contains(out, "\n") {
+		t.Errorf("printed %q, want a single yt-dlp command", out)
+	}
+	// Only the top search result, quoted for the shell, and no secrets
+	if !strings.HasSuffix(out, " 'ytsearch1:rick astley'") {
+		t.Errorf("command %q doesn't end with the quoted search", out)
+	}
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, "--password '[REDACTED]'") {
+		t.Errorf("command %q doesn't redact the password", out)
+	}
+
+	// Nothing ran and nothing was written
+	if len(runner.calls) != 0 {
+		t.Errorf("yt-dlp ran %d times, want 0", len(runner.calls))
+	}
+	if entries, _ := os.ReadDir("."); len(entries) != 0 {
+		t.Errorf("dry run wrote %d files, want none", len(entries))
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"--newline", "--newline"},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "'https://www.youtube.com/watch?v=dQw4w9WgXcQ'"},
+		{"/downloads/%(title)s.%(ext)s", "'/downloads/%(title)s.%(ext)s'"},
+		{"bv*+ba/b", "'bv*+ba/b'"},
+		{"res:1080,fps", "res:1080,fps"},
+		{"two words", "'two words'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+		{"", "''"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.arg); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkListDownloads(b *testing.B) {
+	db := newTestDB(b)
+	playlistID := insertTestPlaylist(b, db, "https://www.youtube.com/playlist?list=PL1", 10)
+	for i := range 1000 {
+		url := fmt.Sprintf("https://www.youtube.com/watch?v=video%06d", i)
+		id, err := db.InsertDownloadWithPlaylist(url, fmt.Sprintf("Video %d", i), playlistID)
+		if err != nil {
+			b.Fatalf("InsertDownloadWithPlaylist: %v", err)
+		}
+		if err := db.UpdateDownloadStatus(id, StatusCompleted, fmt.Sprintf("/downloads/video%d.mp4", i), ""); err != nil {
+			b.Fatalf("UpdateDownloadStatus: %v", err)
+		}
+		if i%10 == 0 {
+			if err := db.AddDownloadFile(id, fmt.Sprintf("/downloads/video%d-chapter1.mp4", i), 1024); err != nil {
+				b.Fatalf("AddDownloadFile: %v", err)
+			}
+		}
+	}
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	old := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = old }()
+
+	for b.Loop() {
+		if err := ListDownloads(db, time.Time{}, time.Time{}); err != nil {
+			b.Fatalf("ListDownloads: %v", err)
+		}
+	}
+}
+
+// fakeDownloads answers metadata and download calls for any video, writing its file
+func fakeDownloads() *fakeRunner {
+	videoID := func(args []string) string {
+		return YouTubeVideoID(args[len(args)-1])
+	}
+	return &fakeRunner{
+		run: func(args []string) (string, string, error) {
+			id := videoID(args)
+			return fmt.Sprintf(`{"id": %q, "title": %q, "channel": "Chan", "duration": 60}`, id, id), "", nil
+		},
+		stream: func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+			path, _ := filepath.Abs(filepath.Join("downloads", videoID(args)+".mp4"))
+			if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "[download] Destination: %s\n", path)
+			return nil
+		},
+	}
+}
+
+// Videos downloaded through one playlist count as downloaded in every playlist that has them
+func TestDownloadPlaylistSharedVideos(t *testing.T) {
+	t.Chdir(t.TempDir())
+	quiet(t)
+	db := newTestDB(t)
+	useRunner(t, fakeDownloads())
+
+	// downloadPlaylist checks yt-dlp is installed before running it
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "yt-dlp"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	videos := testVideos(3)
+	save := func(url string, videos []VideoInfo) string {
+		t.Helper()
+		id, _, err := db.SaveNewPlaylist(url, "Playlist", "", "", videos)
+		if err != nil {
+			t.Fatalf("SaveNewPlaylist: %v", err)
+		}
+		return id
+	}
+	first := save("https://www.youtube.com/playlist?list=PL1", videos[:2])
+	second := save("https://www.youtube.com/playlist?list=PL2", videos[1:])
+	onlyShared := save("https://www.youtube.com/playlist?list=PL3", videos[:1])
+
+	downloaded := func(id string) int {
+		t.Helper()
+		p, err := db.GetPlaylist(id)
+		if err != nil {
+			t.Fatalf("GetPlaylist: %v", err)
+		}
+		return p.VideosDownloaded
+	}
+
+	if err := DownloadPlaylist(db, first, nil); err != nil {
+		t.Fatalf("DownloadPlaylist(first): %v", err)
+	}
+	if got := downloaded(first); got != 2 {
+		t.Errorf("first playlist downloaded = %d, want 2", got)
+	}
+
+	// The shared video isn't pending anymore but still counts
+	if err := DownloadPlaylist(db, second, nil); err != nil {
+		t.Fatalf("DownloadPlaylist(second): %v", err)
+	}
+	if got := downloaded(second); got != 2 {
+		t.Errorf("second playlist downloaded = %d, want 2", got)
+	}
+
+	// Nothing left to download, the count is still brought up to date
+	if err := DownloadPlaylist(db, onlyShared, nil); err != nil {
+		t.Fatalf("DownloadPlaylist(onlyShared): %v", err)
+	}
+	if got := downloaded(onlyShared); got != 1 {
+		t.Errorf("third playlist downloaded = %d, want 1", got)
+	}
+
+	if n, err := db.CountDownloads(StatusCompleted); err != nil || n != 3 {
+		t.Errorf("%d completed downloads, %v, want 3", n, err)
+	}
+}
+
+// Different forms of the same playlist URL import one playlist
+func TestImportPlaylists(t *testing.T) {
+	quiet(t)
+	db := newTestDB(t)
+	runner := &fakeRunner{
+		run: func(args []string) (string, string, error) {
+			return `{"title": "Playlist", "channel": "Chan", "entries": [{"id": "video000001", "title": "One", "url": "https://www.youtube.com/watch?v=video000001"}]}`, "", nil
+		},
+	}
+	useRunner(t, runner)
+
+	// ExtractPlaylistToDB checks yt-dlp is installed before running it
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "yt-dlp"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	input := `["youtube.com/playlist?list=PL1", {"url": "https://www.youtube.com/playlist?list=PL1&si=abc"}, "https://music.youtube.com/playlist?list=PL2"]`
+	if err := db.ImportPlaylists(strings.NewReader(input)); err != nil {
+		t.Fatalf("ImportPlaylists: %v", err)
+	}
+
+	playlists, err := db.GetAllPlaylists()
+	if err != nil {
+		t.Fatalf("GetAllPlaylists: %v", err)
+	}
+	var urls []string
+	for _, p := range playlists {
+		urls = append(urls, p.URL)
+	}
+	slices.Sort(urls)
+	want := []string{"https://www.youtube.com/playlist?list=PL1", "https://www.youtube.com/playlist?list=PL2"}
+	if !slices.Equal(urls, want) {
+		t.Errorf("imported playlists = %q, want %q", urls, want)
+	}
+	if len(runner.calls) != 2 {
+		t.Errorf("yt-dlp ran %d times, want 2", len(runner.calls))
+	}
+}
@@ -0,0 +1,67 @@
+package src
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CompletionFlag describes a wrapper flag for shell completion
+type CompletionFlag struct {
+	Name       string // Without dashes
+	TakesValue bool   // Complete filenames for its value instead of flags
+}
+
+var shellIdentRegex = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// CompletionScript returns a bash, zsh or fish script completing the flags of prog.
+// Only wrapper flags are completed; arguments after a flag's value and URLs complete as filenames
+func CompletionScript(shell, prog string, flags []CompletionFlag) (string, error) {
+	var all, withValue []string
+	for _, f := range flags {
+		all = append(all, "-"+f.Name)
+		if f.TakesValue {
+			withValue = append(withValue, "-"+f.Name, "--"+f.Name)
+		}
+	}
+	fn := "_" + shellIdentRegex.ReplaceAllString(prog, "_")
+
+	var b strings.Builder
+	switch shell {
+	case "bash":
+		fmt.Fprintf(&b, "# bash completion for %s, load with: source <(%s -completion bash)\n", prog, prog)
+		fmt.Fprintf(&b, "%s() {\n", fn)
+		b.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+		if len(withValue) > 0 {
+			fmt.Fprintf(&b, "\tcase \"$prev\" in\n\t\t%s) return ;;\n\tesac\n", strings.Join(withValue, "|"))
+		}
+		fmt.Fprintf(&b, "\tlocal flags=%q\n", strings.Join(all, " "))
+		b.WriteString("\tif [[ \"$cur\" == --* ]]; then\n\t\tflags=\"-${flags// / -}\"\n\tfi\n")
+		b.WriteString("\tif [[ \"$cur\" == -* ]]; then\n\t\tCOMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n\tfi\n")
+		b.WriteString("}\n")
+		fmt.Fprintf(&b, "complete -o default -F %s %s\n", fn, prog)
+	case "zsh":
+		fmt.Fprintf(&b, "#compdef %s\n", prog)
+		fmt.Fprintf(&b, "# zsh completion for %s, load with: source <(%s -completion zsh)\n", prog, prog)
+		fmt.Fprintf(&b, "%s() {\n", fn)
+		fmt.Fprintf(&b, "\tlocal -a flags=(%s)\n", strings.Join(all, " "))
+		fmt.Fprintf(&b, "\tlocal -a value_flags=(%s)\n", strings.Join(withValue, " "))
+		b.WriteString("\tif (( ${value_flags[(Ie)${words[CURRENT-1]}]} )); then\n\t\t_files\n\telif [[ $PREFIX == --* ]]; then\n\t\tcompadd -- ${flags/#-/--}\n\telif [[ $PREFIX == -* ]]; then\n\t\tcompadd -a flags\n\telse\n\t\t_files\n\tfi\n")
+		b.WriteString("}\n")
+		fmt.Fprintf(&b, "compdef %s %s\n", fn, prog)
+	case "fish":
+		fmt.Fprintf(&b, "# fish completion for %s, load with: %s -completion fish | source\n", prog, prog)
+		for _, f := range flags {
+			// -o is a single-dash long option, -l the --name form
+			required := ""
+			if f.TakesValue {
+				required = " -r"
+			}
+			fmt.Fprintf(&b, "complete -c %s -o %s%s\n", prog, f.Name, required)
+			fmt.Fprintf(&b, "complete -c %s -l %s%s\n", prog, f.Name, required)
+		}
+	default:
+		return "", fmt.Errorf("unsupported shell %q (expected bash, zsh or fish)", shell)
+	}
+	return b.String(), nil
+}
@@ -2,12 +2,17 @@ package src
 
 import (
 	"database/sql"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
@@ -20,20 +25,39 @@ const (
 	StatusFailed    DownloadStatus = "failed"
 	StatusPending   DownloadStatus = "pending"
 	StatusCancelled DownloadStatus = "cancelled"
+	// StatusMetadataOnly marks records saved for cataloguing without downloading the video
+	StatusMetadataOnly DownloadStatus = "metadata_only"
+	// StatusSkipped marks downloads yt-dlp finished without writing a file, e.g. filtered out by size
+	StatusSkipped DownloadStatus = "skipped"
 )
 
 type DownloadRecord struct {
+	ID         string         `json:"id"`
+	URL        string         `json:"url"`
+	Title      string         `json:"title"`
+	Channel    string         `json:"channel"`
+	ChannelURL string         `json:"channelUrl"`
+	FilePath   string         `json:"filePath"`
+	Status     DownloadStatus `json:"status"`
+	Error      string         `json:"error"`
+	PlaylistID string         `json:"playlistId"` // Empty for orphan videos
+	FileSize   int64          `json:"fileSize"`   // Bytes on disk once completed, 0 if unknown
+	Duration   int            `json:"duration"`   // Seconds, 0 if unknown
+	UploadDate string         `json:"uploadDate"` // YYYYMMDD, empty if unknown
+	VideoID    string         `json:"videoId"`    // YouTube video ID, empty for other sites
+	LiveStatus string         `json:"liveStatus"` // yt-dlp's live_status for streams and premieres, empty otherwise
+	CreatedAt  time.Time      `json:"createdAt"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+}
+
+// DownloadFile is an extra file a download produced, such as one chapter of a split video.
+// The main file stays in DownloadRecord.FilePath
+type DownloadFile struct {
 	ID         string
-	URL        string
-	Title      string
-	Channel    string
-	ChannelURL string
-	FilePath   string
-	Status     DownloadStatus
-	Error      string
-	PlaylistID string // Empty for orphan videos
+	DownloadID string
+	Path       string
+	Size       int64 // Bytes, 0 if unknown
 	CreatedAt  time.Time
-	UpdatedAt  time.Time
 }
 
 type PlaylistRecord struct {
@@ -49,18 +73,34 @@ type PlaylistRecord struct {
 	UpdatedAt        time.Time
 }
 
+// ChannelRecord is a channel that downloads and playlists link to
+type ChannelRecord struct {
+	ID          string
+	Name        string
+	URL         string
+	CanonicalID string // YouTube channel ID (UC...), empty if the URL doesn't carry one
+	Downloads   int    // Downloads linked to the channel
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
 type PlaylistVideo struct {
-	ID           string
-	PlaylistID   string
-	PlaylistName string
-	VideoURL     string
-	VideoTitle   string
-	VideoID      string
-	Channel      string
-	ChannelURL   string
-	Index        int
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID            string
+	PlaylistID    string
+	PlaylistName  string // The playlist's current title
+	VideoURL      string
+	VideoTitle    string
+	VideoID       string
+	Channel       string
+	ChannelURL    string
+	Index         int
+	Downloaded    bool
+	DownloadID    string
+	ThumbnailPath string
+	ViewCount     *int64 // nil if unknown
+	LikeCount     *int64 // nil if unknown
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
 }
 
 type DB struct {
@@ -72,22 +112,43 @@ func Open(dbPath string) (*DB, error) {
 	_, err := os.Stat(dbPath)
 	isNewDB := os.IsNotExist(err)
 
-	conn, err := sql.Open("sqlite3", dbPath)
+	// Foreign keys are off by default in SQLite and are set per connection,
+	// so enable them in the DSN for every pooled connection. WAL and a busy
+	// timeout let concurrent downloads write without "database is locked" errors
+	db, err := open(dbPath + "?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
 		return nil, err
 	}
 
-	if err := conn.Ping(); err != nil {
-		return nil, err
+	if isNewDB {
+		fmt.Printf("Creating %s...\n", dbPath)
 	}
 
-	db := &DB{conn: conn}
+	return db, nil
+}
 
-	if isNewDB {
-		fmt.Printf("Creating %s...\n", dbPath)
+// OpenMemory opens an empty database that lives in memory until Close, e.g. for tests. It gets the
+// same schema, migrations and per-connection foreign keys as Open, and each call gets its own
+// database. A shared cache lets every pooled connection see it; WAL doesn't apply in memory
+func OpenMemory() (*DB, error) {
+	return open("file:" + uuid.New().String() + "?mode=memory&cache=shared&_foreign_keys=on&_busy_timeout=5000")
+}
+
+// open connects to dsn and brings the schema up to date
+func open(dsn string) (*DB, error) {
+	conn, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
 	}
 
+	db := &DB{conn: conn}
 	if err := db.createTables(); err != nil {
+		conn.Close()
 		return nil, err
 	}
 
@@ -131,7 +192,6 @@ func (db *DB) createTables() error {
 	CREATE TABLE IF NOT EXISTS playlist_videos (
 		id TEXT PRIMARY KEY,
 		playlist_id TEXT NOT NULL,
-		playlist_name TEXT NOT NULL,
 		video_url TEXT NOT NULL,
 		video_title TEXT NOT NULL,
 		video_id TEXT NOT NULL,
@@ -143,10 +203,265 @@ func (db *DB) createTables() error {
 		FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE
 	);
 	CREATE INDEX IF NOT EXISTS idx_playlist_videos_playlist_id ON playlist_videos(playlist_id);
+
+	CREATE TABLE IF NOT EXISTS download_files (
+		id TEXT PRIMARY KEY,
+		download_id TEXT NOT NULL,
+		path TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (download_id) REFERENCES downloads(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_download_files_download_id ON download_files(download_id);
+
+	CREATE TABLE IF NOT EXISTS channels (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		canonical_id TEXT,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_canonical_id ON channels(canonical_id);
+	CREATE INDEX IF NOT EXISTS idx_channels_url ON channels(url);
+
+	CREATE TABLE IF NOT EXISTS download_metadata (
+		download_id TEXT PRIMARY KEY,
+		description TEXT,
+		tags TEXT,
+		categories TEXT,
+		FOREIGN KEY (download_id) REFERENCES downloads(id) ON DELETE CASCADE
+	);
 	`
 
-	_, err := db.conn.Exec(schema)
-	return err
+	if _, err := db.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	return db.migrate()
+}
+
+// columnMigrations lists columns added after the initial schema, applied to existing databases
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"playlist_videos", "downloaded", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"playlist_videos", "download_id", "TEXT"},
+	{"playlist_videos", "thumbnail_path", "TEXT"},
+	{"playlist_videos", "view_count", "INTEGER"},
+	{"playlist_videos", "like_count", "INTEGER"},
+	{"downloads", "file_size", "INTEGER NOT NULL DEFAULT 0"},
+	{"downloads", "duration", "INTEGER NOT NULL DEFAULT 0"},
+	{"downloads", "upload_date", "TEXT"},
+	{"downloads", "video_id", "TEXT"},
+	{"downloads", "live_status", "TEXT"},
+	{"downloads", "channel_id", "TEXT REFERENCES channels(id) ON DELETE SET NULL"},
+	{"playlists", "channel_id", "TEXT REFERENCES channels(id) ON DELETE SET NULL"},
+}
+
+// migrate adds any missing columns to tables created by older versions
+func (db *DB) migrate() error {
+	// Older versions stored orphan downloads with an empty playlist_id, which isn't a valid foreign key
+	if _, err := db.conn.Exec(`UPDATE downloads SET playlist_id = NULL WHERE playlist_id = ''`); err != nil {
+		return err
+	}
+
+	// Older versions inserted playlist videos with an empty playlist_id and attached them to their
+	// playlist afterwards by video ID, which could leave rows that belong to no playlist
+	if _, err := db.conn.Exec(`DELETE FROM playlist_videos WHERE playlist_id NOT IN (SELECT id FROM playlists)`); err != nil {
+		return err
+	}
+
+	added := make(map[string]bool)
+	for _, m := range columnMigrations {
+		exists, err := db.columnExists(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.conn.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, m.table, m.column, m.definition)); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", m.table, m.column, err)
+		}
+		added[m.table+"."+m.column] = true
+	}
+	if added["downloads.video_id"] {
+		if err := db.backfillVideoIDs(); err != nil {
+			return fmt.Errorf("failed to fill in video IDs: %w", err)
+		}
+	}
+	if added["downloads.channel_id"] || added["playlists.channel_id"] {
+		if err := db.backfillChannels(); err != nil {
+			return fmt.Errorf("failed to fill in channels: %w", err)
+		}
+	}
+	if _, err := db.conn.Exec(`CREATE INDEX IF NOT EXISTS idx_video_id ON downloads(video_id);
+		CREATE INDEX IF NOT EXISTS idx_downloads_channel_id ON downloads(channel_id);
+		CREATE INDEX IF NOT EXISTS idx_playlists_channel_id ON playlists(channel_id)`); err != nil {
+		return err
+	}
+
+	// Older versions copied the playlist's title to every video, where it went stale on rename.
+	// It's read from playlists through a JOIN now
+	exists, err := db.columnExists("playlist_videos", "playlist_name")
+	if err != nil {
+		return err
+	}
+	if exists {
+		if _, err := db.conn.Exec(`ALTER TABLE playlist_videos DROP COLUMN playlist_name`); err != nil {
+			return fmt.Errorf("failed to drop playlist_videos.playlist_name: %w", err)
+		}
+	}
+
+	return db.migrateUniquePlaylistVideos()
+}
+
+// backfillVideoIDs sets the video ID of downloads saved before the column existed, parsed from their URL
+func (db *DB) backfillVideoIDs() error {
+	rows, err := db.conn.Query(`SELECT id, url FROM downloads WHERE video_id IS NULL`)
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]string)
+	for rows.Next() {
+		var id, urlStr string
+		if err := rows.Scan(&id, &urlStr); err != nil {
+			rows.Close()
+			return err
+		}
+		if videoID := YouTubeVideoID(urlStr); videoID != "" {
+			ids[id] = videoID
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE downloads SET video_id = ? WHERE id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for id, videoID := range ids {
+		if _, err := stmt.Exec(videoID, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateUniquePlaylistVideos adds the unique (playlist_id, video_id) index, first removing any
+// duplicates older versions saved. The downloaded copy of a duplicate is the one kept
+func (db *DB) migrateUniquePlaylistVideos() error {
+	var exists int
+	if err := db.conn.QueryRow(
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_playlist_videos_unique'`,
+	).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM playlist_videos WHERE rowid NOT IN (
+		SELECT (SELECT p2.rowid FROM playlist_videos p2 WHERE p2.playlist_id = p1.playlist_id AND p2.video_id = p1.video_id ORDER BY p2.downloaded DESC, p2.rowid LIMIT 1)
+		FROM playlist_videos p1 GROUP BY p1.playlist_id, p1.video_id
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to remove duplicate playlist videos: %w", err)
+	}
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		if _, err := tx.Exec(`UPDATE playlists SET videos_saved = (SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = playlists.id)`); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`CREATE UNIQUE INDEX idx_playlist_videos_unique ON playlist_videos(playlist_id, video_id)`); err != nil {
+		return fmt.Errorf("failed to add unique playlist video index: %w", err)
+	}
+	return tx.Commit()
+}
+
+// backfillChannels links downloads and playlists saved before the channels table existed to
+// their channel, going by the channel URL they were saved with
+func (db *DB) backfillChannels() error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"downloads", "playlists"} {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT id, channel, channel_url FROM %s WHERE channel_id IS NULL AND channel_url != ''`, table))
+		if err != nil {
+			return err
+		}
+		type link struct{ id, channel, channelURL string }
+		var links []link
+		for rows.Next() {
+			var l link
+			if err := rows.Scan(&l.id, &l.channel, &l.channelURL); err != nil {
+				rows.Close()
+				return err
+			}
+			links = append(links, l)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, l := range links {
+			channelID, err := ensureChannel(tx, l.channel, l.channelURL)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET channel_id = ? WHERE id = ?`, table), nullString(channelID), l.id); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) columnExists(table, column string) (bool, error) {
+	rows, err := db.conn.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
 func (db *DB) Close() error {
@@ -166,8 +481,8 @@ func (db *DB) InsertDownloadWithPlaylist(urlStr, title, playlistID string) (stri
 
 	now := time.Now()
 	_, err := db.conn.Exec(
-		`INSERT INTO downloads (id, url, title, channel, channel_url, status, playlist_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		id, urlStr, title, "", "", StatusPending, playlistID, now, now,
+		`INSERT INTO downloads (id, url, title, channel, channel_url, status, playlist_id, video_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, urlStr, title, "", "", StatusPending, nullString(playlistID), nullString(YouTubeVideoID(urlStr)), now, now,
 	)
 	if err != nil {
 		return "", err
@@ -175,6 +490,11 @@ func (db *DB) InsertDownloadWithPlaylist(urlStr, title, playlistID string) (stri
 	return id, nil
 }
 
+// nullString maps "" to NULL so optional foreign keys stay valid
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 func (db *DB) UpdateDownloadChannel(id, channel string) error {
 	_, err := db.conn.Exec(
 		`UPDATE downloads SET channel = ?, updated_at = ? WHERE id = ?`,
@@ -224,10 +544,77 @@ func extractTitleFromURL(urlStr string) string {
 	return strings.TrimPrefix(parsed.Host+parsed.Path, "www.")
 }
 
+// maxErrorLength caps a stored error message, which can include yt-dlp's stderr
+const maxErrorLength = 4096
+
+// truncateError keeps the end of an over-long error message, where yt-dlp's final errors are
+func truncateError(msg string) string {
+	if len(msg) <= maxErrorLength {
+		return msg
+	}
+	cut := len(msg) - maxErrorLength
+	for cut < len(msg) && !utf8.RuneStart(msg[cut]) {
+		cut++
+	}
+	return "..." + msg[cut:]
+}
+
 func (db *DB) UpdateDownloadStatus(id string, status DownloadStatus, filePath, errorMsg string) error {
 	_, err := db.conn.Exec(
 		`UPDATE downloads SET status = ?, file_path = ?, error = ?, updated_at = ? WHERE id = ?`,
-		status, filePath, errorMsg, time.Now(), id,
+		status, filePath, truncateError(errorMsg), time.Now(), id,
+	)
+	return err
+}
+
+func (db *DB) UpdateDownloadFileSize(id string, size int64) error {
+	_, err := db.conn.Exec(
+		`UPDATE downloads SET file_size = ?, updated_at = ? WHERE id = ?`,
+		size, time.Now(), id,
+	)
+	return err
+}
+
+func (db *DB) UpdateDownloadDuration(id string, seconds int) error {
+	_, err := db.conn.Exec(
+		`UPDATE downloads SET duration = ?, updated_at = ? WHERE id = ?`,
+		seconds, time.Now(), id,
+	)
+	return err
+}
+
+func (db *DB) UpdateDownloadUploadDate(id, uploadDate string) error {
+	_, err := db.conn.Exec(
+		`UPDATE downloads SET upload_date = ?, updated_at = ? WHERE id = ?`,
+		uploadDate, time.Now(), id,
+	)
+	return err
+}
+
+// UpdateDownloadVideoID sets the YouTube video ID, e.g. from the extracted metadata
+func (db *DB) UpdateDownloadVideoID(id, videoID string) error {
+	_, err := db.conn.Exec(
+		`UPDATE downloads SET video_id = ?, updated_at = ? WHERE id = ?`,
+		nullString(videoID), time.Now(), id,
+	)
+	return err
+}
+
+// UpdateDownloadLiveStatus records that a download is a live stream or premiere
+func (db *DB) UpdateDownloadLiveStatus(id, liveStatus string) error {
+	_, err := db.conn.Exec(
+		`UPDATE downloads SET live_status = ?, updated_at = ? WHERE id = ?`,
+		nullString(liveStatus), time.Now(), id,
+	)
+	return err
+}
+
+// UpdateDownloadURL points a download at a new URL, e.g. the video a search resolved to.
+// The video ID follows the new URL
+func (db *DB) UpdateDownloadURL(id, url string) error {
+	_, err := db.conn.Exec(
+		`UPDATE downloads SET url = ?, video_id = ?, updated_at = ? WHERE id = ?`,
+		url, nullString(YouTubeVideoID(url)), time.Now(), id,
 	)
 	return err
 }
@@ -240,51 +627,464 @@ func (db *DB) UpdateDownloadTitle(id, title string) error {
 	return err
 }
 
-func (db *DB) GetDownload(id string) (*DownloadRecord, error) {
-	row := db.conn.QueryRow(
-		`SELECT id, url, title, channel, channel_url, file_path, status, error, playlist_id, created_at, updated_at FROM downloads WHERE id = ?`,
-		id,
+// AddDownloadFile records an extra file produced by a download
+func (db *DB) AddDownloadFile(downloadID, path string, size int64) error {
+	_, err := db.conn.Exec(
+		`INSERT INTO download_files (id, download_id, path, size, created_at) VALUES (?, ?, ?, ?, ?)`,
+		uuid.New().String(), downloadID, path, size, time.Now(),
+	)
+	return err
+}
+
+// GetDownloadFiles returns the extra files produced by a download, in the order they were written
+func (db *DB) GetDownloadFiles(downloadID string) ([]DownloadFile, error) {
+	rows, err := db.conn.Query(
+		`SELECT id, download_id, path, size, created_at FROM download_files WHERE download_id = ? ORDER BY created_at, path`,
+		downloadID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []DownloadFile
+	for rows.Next() {
+		var f DownloadFile
+		if err := rows.Scan(&f.ID, &f.DownloadID, &f.Path, &f.Size, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// CountDownloadFiles returns how many extra files each download produced, keyed by download ID.
+// Downloads without extra files are left out
+func (db *DB) CountDownloadFiles() (map[string]int, error) {
+	rows, err := db.conn.Query(`SELECT download_id, COUNT(*) FROM download_files GROUP BY download_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// SaveDownloadMetadata stores the description, tags and categories read from a download's
+// .info.json, replacing any saved before. Tags and categories are stored as JSON arrays
+func (db *DB) SaveDownloadMetadata(downloadID, description string, tags, categories []string) error {
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	categoriesJSON, err := json.Marshal(categories)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.conn.Exec(
+		`INSERT OR REPLACE INTO download_metadata (download_id, description, tags, categories) VALUES (?, ?, ?, ?)`,
+		downloadID, nullString(description), string(tagsJSON), string(categoriesJSON),
 	)
+	return err
+}
+
+// downloadColumns are the downloads columns scanDownload reads, in order
+const downloadColumns = `id, url, title, channel, channel_url, COALESCE(file_path, ''), status, COALESCE(error, ''), COALESCE(playlist_id, ''), COALESCE(file_size, 0), COALESCE(duration, 0), COALESCE(upload_date, ''), COALESCE(video_id, ''), COALESCE(live_status, ''), created_at, updated_at`
 
+// joinedDownloadColumns are downloadColumns for queries that join downloads as d
+const joinedDownloadColumns = `d.id, d.url, d.title, d.channel, d.channel_url, COALESCE(d.file_path, ''), d.status, COALESCE(d.error, ''), COALESCE(d.playlist_id, ''), COALESCE(d.file_size, 0), COALESCE(d.duration, 0), COALESCE(d.upload_date, ''), COALESCE(d.video_id, ''), COALESCE(d.live_status, ''), d.created_at, d.updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanDownload scans a row selected with downloadColumns. extra receives any columns selected after them
+func scanDownload(row rowScanner, extra ...any) (DownloadRecord, error) {
 	var d DownloadRecord
-	err := row.Scan(&d.ID, &d.URL, &d.Title, &d.Channel, &d.ChannelURL, &d.FilePath, &d.Status, &d.Error, &d.PlaylistID, &d.CreatedAt, &d.UpdatedAt)
+	dest := []any{&d.ID, &d.URL, &d.Title, &d.Channel, &d.ChannelURL, &d.FilePath, &d.Status, &d.Error, &d.PlaylistID, &d.FileSize, &d.Duration, &d.UploadDate, &d.VideoID, &d.LiveStatus, &d.CreatedAt, &d.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	return d, err
+}
+
+// queryDownloads returns the downloads matching the clauses that follow FROM downloads
+func (db *DB) queryDownloads(clauses string, args ...any) ([]DownloadRecord, error) {
+	rows, err := db.conn.Query(`SELECT `+downloadColumns+` FROM downloads `+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var downloads []DownloadRecord
+	for rows.Next() {
+		d, err := scanDownload(rows)
+		if err != nil {
+			return nil, err
+		}
+		downloads = append(downloads, d)
+	}
+	return downloads, rows.Err()
+}
+
+func (db *DB) GetDownload(id string) (*DownloadRecord, error) {
+	d, err := scanDownload(db.conn.QueryRow(
+		`SELECT `+downloadColumns+` FROM downloads WHERE id = ?`,
+		id,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetDownloadByURL returns the most recent download record for a URL, whatever its status.
+// Returns nil without error if the URL has no record
+func (db *DB) GetDownloadByURL(urlStr string) (*DownloadRecord, error) {
+	normalized := NormalizeURL(urlStr)
+	d, err := scanDownload(db.conn.QueryRow(
+		`SELECT `+downloadColumns+` FROM downloads WHERE url IN (?, ?) ORDER BY created_at DESC LIMIT 1`,
+		normalized, urlStr,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetDownloadByVideoID returns the most recent download record for a YouTube video ID,
+// whatever URL it was downloaded from. Returns nil without error if the video has no record
+func (db *DB) GetDownloadByVideoID(videoID string) (*DownloadRecord, error) {
+	d, err := scanDownload(db.conn.QueryRow(
+		`SELECT `+downloadColumns+` FROM downloads WHERE video_id = ? ORDER BY created_at DESC LIMIT 1`,
+		videoID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &d, nil
 }
 
+// GetCompletedDownloadByURL returns the most recent completed download for a URL, or for
+// the same YouTube video under another URL.
+// Returns nil without error if the URL was never downloaded successfully
+func (db *DB) GetCompletedDownloadByURL(urlStr string) (*DownloadRecord, error) {
+	normalized := NormalizeURL(urlStr)
+	d, err := scanDownload(db.conn.QueryRow(
+		`SELECT `+downloadColumns+` FROM downloads WHERE (url IN (?, ?) OR video_id = ?) AND status = ? ORDER BY updated_at DESC LIMIT 1`,
+		normalized, urlStr, nullString(YouTubeVideoID(urlStr)), StatusCompleted,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetAllDownloads returns every download, newest first
 func (db *DB) GetAllDownloads() ([]DownloadRecord, error) {
+	return db.GetDownloadsPaged(0, 0, "created_at", "desc")
+}
+
+// downloadSortColumns maps the sort keys GetDownloadsPaged accepts to their ORDER BY expression.
+// Only these reach the query, so a sort key can't inject SQL
+var downloadSortColumns = map[string]string{
+	"created_at": "created_at",
+	"title":      "title COLLATE NOCASE",
+	"status":     "status",
+	"size":       "file_size",
+}
+
+// GetDownloadsPaged returns up to limit downloads starting at offset, sorted by sortBy
+// (created_at, title, status or size) in order ("asc" or "desc"). Empty values sort newest
+// first, and a limit of 0 returns every download from offset on
+func (db *DB) GetDownloadsPaged(limit, offset int, sortBy, order string) ([]DownloadRecord, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("invalid limit %d", limit)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid offset %d", offset)
+	}
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+	column, ok := downloadSortColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort %q (expected created_at, title, status or size)", sortBy)
+	}
+	switch strings.ToLower(order) {
+	case "", "desc":
+		order = "DESC"
+	case "asc":
+		order = "ASC"
+	default:
+		return nil, fmt.Errorf("unsupported order %q (expected asc or desc)", order)
+	}
+	// SQLite treats a negative limit as no limit
+	if limit == 0 {
+		limit = -1
+	}
+
+	// The ID breaks ties so pages don't overlap
+	return db.queryDownloads(`ORDER BY `+column+` `+order+`, id LIMIT ? OFFSET ?`, limit, offset)
+}
+
+// createdBetween returns a WHERE clause limiting column to [from, to), or "" if both are zero
+func createdBetween(column string, from, to time.Time) (string, []any) {
+	var conds []string
+	var args []any
+	if !from.IsZero() {
+		conds = append(conds, column+` >= ?`)
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		conds = append(conds, column+` < ?`)
+		args = append(args, to)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return ` WHERE ` + strings.Join(conds, ` AND `), args
+}
+
+// DownloadWithPlaylist is a download along with the title of the playlist it belongs to.
+// PlaylistTitle is NULL for orphan downloads and for playlists that no longer exist
+type DownloadWithPlaylist struct {
+	DownloadRecord
+	PlaylistTitle sql.NullString `json:"-"`
+}
+
+// MarshalJSON adds playlistTitle to the download's fields, null when there is none
+func (d DownloadWithPlaylist) MarshalJSON() ([]byte, error) {
+	type record DownloadRecord
+	var title *string
+	if d.PlaylistTitle.Valid {
+		title = &d.PlaylistTitle.String
+	}
+	return json.Marshal(struct {
+		record
+		PlaylistTitle *string `json:"playlistTitle"`
+	}{record(d.DownloadRecord), title})
+}
+
+// GetAllDownloadsWithPlaylist returns every download with its playlist's title, newest first
+func (db *DB) GetAllDownloadsWithPlaylist() ([]DownloadWithPlaylist, error) {
+	return db.GetDownloadsWithPlaylistBetween(time.Time{}, time.Time{})
+}
+
+// GetDownloadsWithPlaylistBetween is GetDownloadsBetween with each download's playlist title,
+// joined in the same query
+func (db *DB) GetDownloadsWithPlaylistBetween(from, to time.Time) ([]DownloadWithPlaylist, error) {
+	where, args := createdBetween("d.created_at", from, to)
 	rows, err := db.conn.Query(
-		`SELECT id, url, title, channel, channel_url, file_path, status, error, playlist_id, created_at, updated_at FROM downloads ORDER BY created_at DESC`,
+		`SELECT `+joinedDownloadColumns+`, p.title FROM downloads d LEFT JOIN playlists p ON p.id = d.playlist_id`+where+` ORDER BY d.created_at DESC`,
+		args...,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var downloads []DownloadRecord
+	var downloads []DownloadWithPlaylist
 	for rows.Next() {
-		var d DownloadRecord
-		if err := rows.Scan(&d.ID, &d.URL, &d.Title, &d.Channel, &d.ChannelURL, &d.FilePath, &d.Status, &d.Error, &d.PlaylistID, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		var d DownloadWithPlaylist
+		record, err := scanDownload(rows, &d.PlaylistTitle)
+		if err != nil {
 			return nil, err
 		}
+		d.DownloadRecord = record
 		downloads = append(downloads, d)
 	}
 	return downloads, rows.Err()
 }
 
+// GetDownloadsBetween returns downloads created in [from, to), newest first.
+// A zero from or to leaves that side of the window open
+func (db *DB) GetDownloadsBetween(from, to time.Time) ([]DownloadRecord, error) {
+	where, args := createdBetween("created_at", from, to)
+	return db.queryDownloads(where+` ORDER BY created_at DESC`, args...)
+}
+
+// CountDownloads returns how many downloads are in any of the given statuses, or how many
+// there are in total without a status
+func (db *DB) CountDownloads(statuses ...DownloadStatus) (int, error) {
+	query := `SELECT COUNT(*) FROM downloads`
+	args := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		args[i] = status
+	}
+	if len(statuses) > 0 {
+		query += ` WHERE status IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ") + `)`
+	}
+
+	var count int
+	err := db.conn.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// CountPlaylists returns how many playlists are saved
+func (db *DB) CountPlaylists() (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM playlists`).Scan(&count)
+	return count, err
+}
+
+// GetDownloadsByStatus returns downloads in any of the given statuses, oldest first
+func (db *DB) GetDownloadsByStatus(statuses ...DownloadStatus) ([]DownloadRecord, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")
+	args := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		args[i] = status
+	}
+
+	return db.queryDownloads(`WHERE status IN (`+placeholders+`) ORDER BY created_at`, args...)
+}
+
+// GetOrphanDownloads returns downloads that aren't associated with any playlist
+func (db *DB) GetOrphanDownloads() ([]DownloadRecord, error) {
+	return db.queryDownloads(`WHERE playlist_id = '' OR playlist_id IS NULL ORDER BY created_at DESC`)
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx, so helpers can run inside a transaction or not
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// ensureChannel returns the ID of the channel at channelURL, adding the channel if it's new.
+// A channel is matched by its canonical ID when the URL has one (/channel/UC...), by URL
+// otherwise, and a changed name is updated. Returns "" without error if channelURL is empty
+func ensureChannel(ex execer, name, channelURL string) (string, error) {
+	channelURL = CleanChannelURL(channelURL)
+	if channelURL == "" {
+		return "", nil
+	}
+	canonicalID := ChannelIDFromURL(channelURL)
+
+	var id, storedName string
+	var err error
+	if canonicalID != "" {
+		err = ex.QueryRow(`SELECT id, name FROM channels WHERE canonical_id = ?`, canonicalID).Scan(&id, &storedName)
+	} else {
+		err = ex.QueryRow(`SELECT id, name FROM channels WHERE url = ?`, channelURL).Scan(&id, &storedName)
+	}
+	now := time.Now()
+	if err == sql.ErrNoRows {
+		if name == "" {
+			name = extractChannelNameFromURL(channelURL)
+		}
+		id = uuid.New().String()
+		_, err = ex.Exec(
+			`INSERT INTO channels (id, name, url, canonical_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			id, name, channelURL, nullString(canonicalID), now, now,
+		)
+		if err != nil {
+			return "", err
+		}
+		return id, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if name != "" && name != storedName {
+		if _, err := ex.Exec(`UPDATE channels SET name = ?, updated_at = ? WHERE id = ?`, name, now, id); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// LinkDownloadChannel links a download to its channel, adding the channel if it's new
+func (db *DB) LinkDownloadChannel(downloadID, name, channelURL string) error {
+	channelID, err := ensureChannel(db.conn, name, channelURL)
+	if err != nil || channelID == "" {
+		return err
+	}
+	_, err = db.conn.Exec(`UPDATE downloads SET channel_id = ? WHERE id = ?`, channelID, downloadID)
+	return err
+}
+
+// GetChannels returns every channel with its number of downloads, by name
+func (db *DB) GetChannels() ([]ChannelRecord, error) {
+	rows, err := db.conn.Query(
+		`SELECT c.id, c.name, c.url, COALESCE(c.canonical_id, ''), (SELECT COUNT(*) FROM downloads d WHERE d.channel_id = c.id), c.created_at, c.updated_at FROM channels c ORDER BY c.name COLLATE NOCASE`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []ChannelRecord
+	for rows.Next() {
+		var c ChannelRecord
+		if err := rows.Scan(&c.ID, &c.Name, &c.URL, &c.CanonicalID, &c.Downloads, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+// GetChannel returns a channel by ID
+func (db *DB) GetChannel(id string) (*ChannelRecord, error) {
+	var c ChannelRecord
+	err := db.conn.QueryRow(
+		`SELECT c.id, c.name, c.url, COALESCE(c.canonical_id, ''), (SELECT COUNT(*) FROM downloads d WHERE d.channel_id = c.id), c.created_at, c.updated_at FROM channels c WHERE c.id = ?`,
+		id,
+	).Scan(&c.ID, &c.Name, &c.URL, &c.CanonicalID, &c.Downloads, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetDownloadsByChannel returns the downloads linked to a channel, newest first
+func (db *DB) GetDownloadsByChannel(channelID string) ([]DownloadRecord, error) {
+	return db.queryDownloads(`WHERE channel_id = ? ORDER BY created_at DESC`, channelID)
+}
+
 func (db *DB) InsertPlaylist(url, title, channel, channelURL string, totalVideos, videosSaved int) (string, error) {
+	return insertPlaylist(db.conn, url, title, channel, channelURL, totalVideos, videosSaved)
+}
+
+func insertPlaylist(ex execer, url, title, channel, channelURL string, totalVideos, videosSaved int) (string, error) {
 	id := uuid.New().String()
 
 	if title == "" {
 		title = extractTitleFromURL(url)
 	}
 
+	channelID, err := ensureChannel(ex, channel, channelURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to save channel: %w", err)
+	}
+
 	now := time.Now()
-	_, err := db.conn.Exec(
-		`INSERT INTO playlists (id, url, title, channel, channel_url, total_videos, videos_saved, videos_downloaded, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		id, url, title, channel, channelURL, totalVideos, videosSaved, 0, now, now,
+	_, err = ex.Exec(
+		`INSERT INTO playlists (id, url, title, channel, channel_url, channel_id, total_videos, videos_saved, videos_downloaded, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, url, title, channel, channelURL, nullString(channelID), totalVideos, videosSaved, 0, now, now,
 	)
 	if err != nil {
 		return "", err
@@ -300,6 +1100,88 @@ func (db *DB) UpdatePlaylistCounts(id string, totalVideos, videosSaved, videosDo
 	return err
 }
 
+// UpdatePlaylistMetadata stores a playlist's current title and channel. Its videos read the
+// title through a JOIN, so they pick up a rename too
+func (db *DB) UpdatePlaylistMetadata(id, title, channel, channelURL string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	channelID, err := ensureChannel(tx, channel, channelURL)
+	if err != nil {
+		return fmt.Errorf("failed to save channel: %w", err)
+	}
+	if _, err := tx.Exec(
+		`UPDATE playlists SET title = ?, channel = ?, channel_url = ?, channel_id = ?, updated_at = ? WHERE id = ?`,
+		title, channel, channelURL, nullString(channelID), time.Now(), id,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveNewPlaylist inserts a playlist together with its videos and returns its ID and how many
+// videos were saved; a video listed twice is saved once. It's one transaction, so an
+// interrupted or failed save leaves no trace
+func (db *DB) SaveNewPlaylist(url, title, channel, channelURL string, videos []VideoInfo) (string, int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return "", 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertPlaylist(tx, url, title, channel, channelURL, len(videos), 0)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to insert playlist: %w", err)
+	}
+	saved, err := insertPlaylistVideos(tx, id, videos)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to insert videos: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE playlists SET videos_saved = ? WHERE id = ?`, len(saved), id); err != nil {
+		return "", 0, fmt.Errorf("failed to update playlist counts: %w", err)
+	}
+	return id, len(saved), tx.Commit()
+}
+
+// AddPlaylistVideos saves the videos that aren't saved for a playlist yet and updates its
+// counts, with totalVideos as the playlist's current size. videos_saved is recounted rather
+// than incremented, so an earlier miscount doesn't carry over. It's one transaction, so on
+// failure the playlist is left as it was. The added videos are returned
+func (db *DB) AddPlaylistVideos(playlistID string, videos []VideoInfo, totalVideos int) ([]VideoInfo, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := playlistVideoIDs(tx, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	var missing []VideoInfo
+	for _, video := range videos {
+		if !existing[video.ID] {
+			missing = append(missing, video)
+		}
+	}
+
+	// The unique index catches anything saved since the IDs were read
+	added, err := insertPlaylistVideos(tx, playlistID, missing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert videos: %w", err)
+	}
+	if _, err := tx.Exec(
+		`UPDATE playlists SET total_videos = ?, videos_saved = (SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = ?), updated_at = ? WHERE id = ?`,
+		totalVideos, playlistID, time.Now(), playlistID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to update playlist counts: %w", err)
+	}
+	return added, tx.Commit()
+}
+
 func (db *DB) GetPlaylist(id string) (*PlaylistRecord, error) {
 	row := db.conn.QueryRow(
 		`SELECT id, url, title, channel, channel_url, total_videos, videos_saved, videos_downloaded, created_at, updated_at FROM playlists WHERE id = ?`,
@@ -328,12 +1210,157 @@ func (db *DB) GetPlaylistByURL(url string) (*PlaylistRecord, error) {
 	return &p, nil
 }
 
-func (db *DB) InsertPlaylistVideo(playlistID, playlistName, videoURL, videoTitle, videoID, channel, channelURL string, index int) error {
+// DeleteDownload removes a download record along with its file and metadata records
+// (ON DELETE CASCADE). The downloaded file itself is kept, and playlist videos that
+// pointed at the record are unlinked from it
+func (db *DB) DeleteDownload(id string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE playlist_videos SET download_id = NULL WHERE download_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM downloads WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// PurgeByStatus deletes every download with the given status and returns how many were deleted.
+// Like DeleteDownload, files are kept and playlist videos are unlinked
+func (db *DB) PurgeByStatus(status DownloadStatus) (int, error) {
+	return db.PurgeByStatusBefore(status, time.Time{})
+}
+
+// PurgeByStatusBefore deletes the downloads with the given status created before cutoff,
+// or all of them when cutoff is zero, and returns how many were deleted
+func (db *DB) PurgeByStatusBefore(status DownloadStatus, cutoff time.Time) (int, error) {
+	where := `status = ?`
+	args := []any{status}
+	if !cutoff.IsZero() {
+		where += ` AND created_at < ?`
+		args = append(args, cutoff)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE playlist_videos SET download_id = NULL WHERE download_id IN (SELECT id FROM downloads WHERE `+where+`)`, args...); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`DELETE FROM downloads WHERE `+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), tx.Commit()
+}
+
+// DeletePlaylist removes a playlist along with its saved videos (ON DELETE CASCADE).
+// Downloads made from the playlist are kept; their playlist_id is set to NULL so they
+// become orphan downloads
+func (db *DB) DeletePlaylist(id string) error {
+	result, err := db.conn.Exec(`DELETE FROM playlists WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// InsertPlaylistVideo saves a video to a playlist and reports whether it was inserted.
+// A video already saved for the playlist is left alone
+func (db *DB) InsertPlaylistVideo(playlistID, videoURL, videoTitle, videoID, channel, channelURL string, index int) (bool, error) {
 	id := uuid.New().String()
 	now := time.Now()
+	result, err := db.conn.Exec(
+		`INSERT OR IGNORE INTO playlist_videos (id, playlist_id, video_url, video_title, video_id, channel, channel_url, idx, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, playlistID, videoURL, videoTitle, videoID, channel, channelURL, index, now, now,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// insertPlaylistVideos saves videos to a playlist, with their view and like counts, using one
+// prepared statement, and returns the ones inserted. Videos already saved for the playlist are
+// skipped. It stops at the first video that fails so the transaction can be rolled back
+func insertPlaylistVideos(tx *sql.Tx, playlistID string, videos []VideoInfo) ([]VideoInfo, error) {
+	if len(videos) == 0 {
+		return nil, nil
+	}
+
+	stmt, err := tx.Prepare(
+		`INSERT OR IGNORE INTO playlist_videos (id, playlist_id, video_url, video_title, video_id, channel, channel_url, idx, view_count, like_count, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	var inserted []VideoInfo
+	for _, v := range videos {
+		result, err := stmt.Exec(uuid.New().String(), playlistID, v.URL, v.Title, v.ID, v.Channel, v.ChannelURL, v.Index, v.ViewCount, v.LikeCount, now, now)
+		if err != nil {
+			return nil, fmt.Errorf("video %s: %w", v.ID, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			inserted = append(inserted, v)
+		}
+	}
+	return inserted, nil
+}
+
+// playlistVideoIDs returns the IDs of the videos saved for a playlist
+func playlistVideoIDs(tx *sql.Tx, playlistID string) (map[string]bool, error) {
+	rows, err := tx.Query(`SELECT video_id FROM playlist_videos WHERE playlist_id = ?`, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// UpdatePlaylistVideoCounts stores the view and like counts of a playlist video. Nil counts are stored as unknown
+func (db *DB) UpdatePlaylistVideoCounts(playlistID, videoID string, views, likes *int64) error {
 	_, err := db.conn.Exec(
-		`INSERT INTO playlist_videos (id, playlist_id, playlist_name, video_url, video_title, video_id, channel, channel_url, idx, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		id, playlistID, playlistName, videoURL, videoTitle, videoID, channel, channelURL, index, now, now,
+		`UPDATE playlist_videos SET view_count = ?, like_count = ?, updated_at = ? WHERE playlist_id = ? AND video_id = ?`,
+		views, likes, time.Now(), playlistID, videoID,
 	)
 	return err
 }
@@ -370,10 +1397,32 @@ func (db *DB) VideoExistsInPlaylist(playlistID, videoID string) (bool, error) {
 	return count > 0, nil
 }
 
-func (db *DB) GetPlaylistVideos(playlistID string) ([]PlaylistVideo, error) {
+// MarkPlaylistVideoDownloaded links a video to its download in every playlist that contains it
+func (db *DB) MarkPlaylistVideoDownloaded(videoID, downloadID string) error {
+	_, err := db.conn.Exec(
+		`UPDATE playlist_videos SET downloaded = 1, download_id = ?, updated_at = ? WHERE video_id = ?`,
+		downloadID, time.Now(), videoID,
+	)
+	return err
+}
+
+// UpdatePlaylistVideoThumbnail stores the cached thumbnail path for a video in every playlist that contains it
+func (db *DB) UpdatePlaylistVideoThumbnail(videoID, thumbnailPath string) error {
+	_, err := db.conn.Exec(
+		`UPDATE playlist_videos SET thumbnail_path = ?, updated_at = ? WHERE video_id = ?`,
+		thumbnailPath, time.Now(), videoID,
+	)
+	return err
+}
+
+// playlistVideoColumns are the columns queryPlaylistVideos reads, in order. p is the video's playlist
+const playlistVideoColumns = `pv.id, pv.playlist_id, p.title, pv.video_url, pv.video_title, pv.video_id, pv.channel, pv.channel_url, pv.idx, pv.downloaded, COALESCE(pv.download_id, ''), COALESCE(pv.thumbnail_path, ''), pv.view_count, pv.like_count, pv.created_at, pv.updated_at`
+
+// queryPlaylistVideos returns the playlist videos matching the clauses that follow the FROM
+func (db *DB) queryPlaylistVideos(clauses string, args ...any) ([]PlaylistVideo, error) {
 	rows, err := db.conn.Query(
-		`SELECT id, playlist_id, playlist_name, video_url, video_title, video_id, channel, channel_url, idx, created_at, updated_at FROM playlist_videos WHERE playlist_id = ? ORDER BY idx`,
-		playlistID,
+		`SELECT `+playlistVideoColumns+` FROM playlist_videos pv JOIN playlists p ON p.id = pv.playlist_id `+clauses,
+		args...,
 	)
 	if err != nil {
 		return nil, err
@@ -383,10 +1432,141 @@ func (db *DB) GetPlaylistVideos(playlistID string) ([]PlaylistVideo, error) {
 	var videos []PlaylistVideo
 	for rows.Next() {
 		var v PlaylistVideo
-		if err := rows.Scan(&v.ID, &v.PlaylistID, &v.PlaylistName, &v.VideoURL, &v.VideoTitle, &v.VideoID, &v.Channel, &v.ChannelURL, &v.Index, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		if err := rows.Scan(&v.ID, &v.PlaylistID, &v.PlaylistName, &v.VideoURL, &v.VideoTitle, &v.VideoID, &v.Channel, &v.ChannelURL, &v.Index, &v.Downloaded, &v.DownloadID, &v.ThumbnailPath, &v.ViewCount, &v.LikeCount, &v.CreatedAt, &v.UpdatedAt); err != nil {
 			return nil, err
 		}
 		videos = append(videos, v)
 	}
 	return videos, rows.Err()
 }
+
+func (db *DB) GetPlaylistVideos(playlistID string) ([]PlaylistVideo, error) {
+	return db.queryPlaylistVideos(`WHERE pv.playlist_id = ? ORDER BY pv.idx`, playlistID)
+}
+
+// GetPlaylistVideosSortedByViews returns the videos of a playlist, most viewed first.
+// Videos without a known view count come last, in playlist order
+func (db *DB) GetPlaylistVideosSortedByViews(playlistID string) ([]PlaylistVideo, error) {
+	return db.queryPlaylistVideos(`WHERE pv.playlist_id = ? ORDER BY pv.view_count IS NULL, pv.view_count DESC, pv.idx`, playlistID)
+}
+
+// GetPlaylistVideosPaged returns up to limit videos of a playlist starting at offset, ordered by index.
+// An offset past the last video returns an empty slice
+func (db *DB) GetPlaylistVideosPaged(playlistID string, limit, offset int) ([]PlaylistVideo, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("invalid limit %d", limit)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid offset %d", offset)
+	}
+
+	videos, err := db.queryPlaylistVideos(`WHERE pv.playlist_id = ? ORDER BY pv.idx LIMIT ? OFFSET ?`, playlistID, limit, offset)
+	if videos == nil && err == nil {
+		videos = []PlaylistVideo{}
+	}
+	return videos, err
+}
+
+// CountPlaylistVideos returns how many videos are saved for a playlist
+func (db *DB) CountPlaylistVideos(playlistID string) (int, error) {
+	var count int
+	err := db.conn.QueryRow(
+		`SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = ?`,
+		playlistID,
+	).Scan(&count)
+	return count, err
+}
+
+// CountDownloadedPlaylistVideos returns how many videos of a playlist are marked downloaded,
+// including those marked through another playlist that shares them
+func (db *DB) CountDownloadedPlaylistVideos(playlistID string) (int, error) {
+	var count int
+	err := db.conn.QueryRow(
+		`SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = ? AND downloaded = 1`,
+		playlistID,
+	).Scan(&count)
+	return count, err
+}
+
+// ExportDownloadsCSV writes every download record as CSV with a header row.
+// Timestamps are formatted as RFC3339
+func (db *DB) ExportDownloadsCSV(w io.Writer) error {
+	rows, err := db.conn.Query(
+		`SELECT ` + downloadColumns + ` FROM downloads ORDER BY created_at`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cw := csv.NewWriter(w)
+	header := []string{"id", "url", "title", "channel", "channel_url", "file_path", "status", "error", "playlist_id", "file_size", "duration", "upload_date", "video_id", "live_status", "created_at", "updated_at"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		d, err := scanDownload(rows)
+		if err != nil {
+			return err
+		}
+		record := []string{
+			d.ID, d.URL, d.Title, d.Channel, d.ChannelURL, d.FilePath, string(d.Status), d.Error, d.PlaylistID,
+			strconv.FormatInt(d.FileSize, 10), strconv.Itoa(d.Duration), d.UploadDate, d.VideoID, d.LiveStatus,
+			d.CreatedAt.Format(time.RFC3339), d.UpdatedAt.Format(time.RFC3339),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Stats summarizes the download history
+type Stats struct {
+	TotalDownloads int
+	ByStatus       map[DownloadStatus]int
+	TotalBytes     int64
+	Playlists      int
+	PendingVideos  int // Playlist videos saved but not downloaded yet
+}
+
+// GetStats aggregates download and playlist counts
+func (db *DB) GetStats() (*Stats, error) {
+	stats := &Stats{ByStatus: make(map[DownloadStatus]int)}
+
+	rows, err := db.conn.Query(`SELECT status, COUNT(*), COALESCE(SUM(file_size), 0) FROM downloads GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status DownloadStatus
+		var count int
+		var bytes int64
+		if err := rows.Scan(&status, &count, &bytes); err != nil {
+			return nil, err
+		}
+		stats.ByStatus[status] = count
+		stats.TotalDownloads += count
+		stats.TotalBytes += bytes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if stats.Playlists, err = db.CountPlaylists(); err != nil {
+		return nil, err
+	}
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM playlist_videos WHERE downloaded = 0`).Scan(&stats.PendingVideos); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,551 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestDB opens an empty in-memory database that is closed when the test ends
+func newTestDB(t testing.TB) *DB {
+	t.Helper()
+	db, err := OpenMemory()
+	if err != nil {
+		t.Fatalf("OpenMemory: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// insertDownload adds a download record and fails the test if it can't
+func insertDownload(t testing.TB, db *DB, url, title string, status DownloadStatus) string {
+	t.Helper()
+	id, err := db.InsertDownload(url, title)
+	if err != nil {
+		t.Fatalf("InsertDownload(%q): %v", url, err)
+	}
+	if status != StatusPending {
+		if err := db.UpdateDownloadStatus(id, status, "", ""); err != nil {
+			t.Fatalf("UpdateDownloadStatus: %v", err)
+		}
+	}
+	return id
+}
+
+func TestOpenMemoryIsolated(t *testing.T) {
+	first, second := newTestDB(t), newTestDB(t)
+	insertDownload(t, first, "https://example.com/a", "a", StatusPending)
+
+	if n, err := first.CountDownloads(); err != nil || n != 1 {
+		t.Errorf("first CountDownloads() = %d, %v, want 1", n, err)
+	}
+	if n, err := second.CountDownloads(); err != nil || n != 0 {
+		t.Errorf("second CountDownloads() = %d, %v, want 0", n, err)
+	}
+}
+
+func TestDownloadLifecycle(t *testing.T) {
+	db := newTestDB(t)
+
+	id, err := db.InsertDownload("https://www.youtube.com/watch?v=dQw4w9WgXcQ", "Never Gonna Give You Up")
+	if err != nil {
+		t.Fatalf("InsertDownload: %v", err)
+	}
+
+	d, err := db.GetDownload(id)
+	if err != nil {
+		t.Fatalf("GetDownload: %v", err)
+	}
+	if d.Status != StatusPending || d.Title != "Never Gonna Give You Up" || d.VideoID != "dQw4w9WgXcQ" {
+		t.Errorf("new download = %+v, want pending with its title and video ID", d)
+	}
+	if done, err := db.GetCompletedDownloadByURL(d.URL); err != nil || done != nil {
+		t.Errorf("GetCompletedDownloadByURL before completion = %v, %v, want nil", done, err)
+	}
+
+	if err := db.UpdateDownloadChannel(id, "Rick Astley"); err != nil {
+		t.Fatalf("UpdateDownloadChannel: %v", err)
+	}
+	if err := db.UpdateDownloadDuration(id, 213); err != nil {
+		t.Fatalf("UpdateDownloadDuration: %v", err)
+	}
+	if err := db.UpdateDownloadStatus(id, StatusCompleted, "/downloads/rick.mp4", ""); err != nil {
+		t.Fatalf("UpdateDownloadStatus: %v", err)
+	}
+	if err := db.UpdateDownloadFileSize(id, 1024); err != nil {
+		t.Fatalf("UpdateDownloadFileSize: %v", err)
+	}
+
+	d, err = db.GetDownload(id)
+	if err != nil {
+		t.Fatalf("GetDownload: %v", err)
+	}
+	want := DownloadRecord{
+		ID:        id,
+		URL:       "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		Title:     "Never Gonna Give You Up",
+		Channel:   "Rick Astley",
+		FilePath:  "/downloads/rick.mp4",
+		Status:    StatusCompleted,
+		FileSize:  1024,
+		Duration:  213,
+		VideoID:   "dQw4w9WgXcQ",
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+	if *d != want {
+		t.Errorf("completed download = %+v, want %+v", *d, want)
+	}
+	if d.UpdatedAt.Before(d.CreatedAt) {
+		t.Errorf("UpdatedAt %v is before CreatedAt %v", d.UpdatedAt, d.CreatedAt)
+	}
+
+	// The same video under other URL forms finds the record
+	for _, url := range []string{"https://youtu.be/dQw4w9WgXcQ", "youtube.com/shorts/dQw4w9WgXcQ"} {
+		done, err := db.GetCompletedDownloadByURL(url)
+		if err != nil || done == nil || done.ID != id {
+			t.Errorf("GetCompletedDownloadByURL(%q) = %v, %v, want %s", url, done, err, id)
+		}
+	}
+	if byID, err := db.GetDownloadByVideoID("dQw4w9WgXcQ"); err != nil || byID == nil || byID.ID != id {
+		t.Errorf("GetDownloadByVideoID = %v, %v, want %s", byID, err, id)
+	}
+	if byURL, err := db.GetDownloadByURL("https://www.youtube.com/watch?v=dQw4w9WgXcQ#t=5"); err != nil || byURL == nil || byURL.ID != id {
+		t.Errorf("GetDownloadByURL = %v, %v, want %s", byURL, err, id)
+	}
+
+	// Unknown records aren't errors for the lookups that return nil
+	if missing, err := db.GetDownloadByURL("https://example.com/missing"); err != nil || missing != nil {
+		t.Errorf("GetDownloadByURL(missing) = %v, %v, want nil, nil", missing, err)
+	}
+	if missing, err := db.GetDownloadByVideoID("xxxxxxxxxxx"); err != nil || missing != nil {
+		t.Errorf("GetDownloadByVideoID(missing) = %v, %v, want nil, nil", missing, err)
+	}
+	if _, err := db.GetDownload("missing"); err == nil {
+		t.Error("GetDownload(missing) succeeded, want an error")
+	}
+}
+
+func TestGetDownloadsPaged(t *testing.T) {
+	db := newTestDB(t)
+	titles := []string{"delta", "Alpha", "echo", "charlie", "Bravo"}
+	for i, title := range titles {
+		id := insertDownload(t, db, "https://example.com/"+title, title, StatusPending)
+		if err := db.UpdateDownloadFileSize(id, int64(i+1)*100); err != nil {
+			t.Fatalf("UpdateDownloadFileSize: %v", err)
+		}
+	}
+
+	pageTitles := func(limit, offset int, sortBy, order string) []string {
+		t.Helper()
+		downloads, err := db.GetDownloadsPaged(limit, offset, sortBy, order)
+		if err != nil {
+			t.Fatalf("GetDownloadsPaged(%d, %d, %q, %q): %v", limit, offset, sortBy, order, err)
+		}
+		var got []string
+		for _, d := range downloads {
+			got = append(got, d.Title)
+		}
+		return got
+	}
+
+	tests := []struct {
+		limit, offset int
+		sortBy, order string
+		want          []string
+	}{
+		{2, 0, "title", "asc", []string{"Alpha", "Bravo"}},
+		{2, 2, "title", "asc", []string{"charlie", "delta"}},
+		{2, 4, "title", "asc", []string{"echo"}},
+		{2, 5, "title", "asc", nil},
+		{2, 0, "title", "desc", []string{"echo", "delta"}},
+		{0, 3, "title", "ASC", []string{"delta", "echo"}},
+		{3, 0, "size", "desc", []string{"Bravo", "charlie", "echo"}},
+		{1, 0, "", "", []string{"Bravo"}}, // Newest first
+		{0, 0, "created_at", "asc", titles},
+	}
+	for _, tt := range tests {
+		if got := pageTitles(tt.limit, tt.offset, tt.sortBy, tt.order); !slices.Equal(got, tt.want) {
+			t.Errorf("GetDownloadsPaged(%d, %d, %q, %q) = %q, want %q", tt.limit, tt.offset, tt.sortBy, tt.order, got, tt.want)
+		}
+	}
+
+	all, err := db.GetAllDownloads()
+	if err != nil || len(all) != len(titles) {
+		t.Errorf("GetAllDownloads() returned %d downloads, %v, want %d", len(all), err, len(titles))
+	}
+
+	invalid := []struct {
+		limit, offset int
+		sortBy, order string
+	}{
+		{-1, 0, "", ""},
+		{0, -1, "", ""},
+		{0, 0, "url", ""},
+		{0, 0, "title; DROP TABLE downloads", ""},
+		{0, 0, "title", "sideways"},
+	}
+	for _, tt := range invalid {
+		if _, err := db.GetDownloadsPaged(tt.limit, tt.offset, tt.sortBy, tt.order); err == nil {
+			t.Errorf("GetDownloadsPaged(%d, %d, %q, %q) succeeded, want an error", tt.limit, tt.offset, tt.sortBy, tt.order)
+		}
+	}
+}
+
+func TestCountDownloads(t *testing.T) {
+	db := newTestDB(t)
+	for i, status := range []DownloadStatus{StatusCompleted, StatusCompleted, StatusFailed, StatusPending, StatusSkipped} {
+		insertDownload(t, db, "https://example.com/"+string(rune('a'+i)), "", status)
+	}
+
+	tests := []struct {
+		statuses []DownloadStatus
+		want     int
+	}{
+		{nil, 5},
+		{[]DownloadStatus{StatusCompleted}, 2},
+		{[]DownloadStatus{StatusFailed, StatusSkipped}, 2},
+		{[]DownloadStatus{StatusCancelled}, 0},
+	}
+	for _, tt := range tests {
+		if got, err := db.CountDownloads(tt.statuses...); err != nil || got != tt.want {
+			t.Errorf("CountDownloads(%v) = %d, %v, want %d", tt.statuses, got, err, tt.want)
+		}
+	}
+
+	if n, err := db.CountPlaylists(); err != nil || n != 0 {
+		t.Errorf("CountPlaylists() = %d, %v, want 0", n, err)
+	}
+	if _, err := db.InsertPlaylist("https://www.youtube.com/playlist?list=PL1", "Mix", "", "", 0, 0); err != nil {
+		t.Fatalf("InsertPlaylist: %v", err)
+	}
+	if n, err := db.CountPlaylists(); err != nil || n != 1 {
+		t.Errorf("CountPlaylists() = %d, %v, want 1", n, err)
+	}
+}
+
+// testVideos returns n playlist entries, numbered from 1
+func testVideos(n int) []VideoInfo {
+	videos := make([]VideoInfo, n)
+	for i := range videos {
+		id := fmt.Sprintf("video%06d", i+1)
+		videos[i] = VideoInfo{URL: "https://www.youtube.com/watch?v=" + id, Title: "Video " + strconv.Itoa(i+1), ID: id, Index: i + 1}
+	}
+	return videos
+}
+
+// insertTestPlaylist saves a playlist of testVideos(n) and returns its ID
+func insertTestPlaylist(t testing.TB, db *DB, url string, n int) string {
+	t.Helper()
+	playlistID, saved, err := db.SaveNewPlaylist(url, "Playlist", "", "", testVideos(n))
+	if err != nil {
+		t.Fatalf("SaveNewPlaylist(%q): %v", url, err)
+	}
+	if saved != n {
+		t.Fatalf("SaveNewPlaylist(%q) saved %d videos, want %d", url, saved, n)
+	}
+	return playlistID
+}
+
+func TestGetPlaylistVideosPaged(t *testing.T) {
+	db := newTestDB(t)
+	id := insertTestPlaylist(t, db, "https://www.youtube.com/playlist?list=PL1", 5)
+	insertTestPlaylist(t, db, "https://www.youtube.com/playlist?list=PL2", 3)
+
+	tests := []struct {
+		limit, offset int
+		want          []int
+	}{
+		{2, 0, []int{1, 2}},
+		{2, 2, []int{3, 4}},
+		{2, 4, []int{5}},
+		{10, 0, []int{1, 2, 3, 4, 5}},
+		{2, 5, []int{}},
+		{2, 100, []int{}},
+		{0, 0, []int{}},
+	}
+	for _, tt := range tests {
+		videos, err := db.GetPlaylistVideosPaged(id, tt.limit, tt.offset)
+		if err != nil {
+			t.Fatalf("GetPlaylistVideosPaged(%d, %d): %v", tt.limit, tt.offset, err)
+		}
+		if videos == nil {
+			t.Errorf("GetPlaylistVideosPaged(%d, %d) = nil, want an empty slice", tt.limit, tt.offset)
+		}
+		got := []int{}
+		for _, v := range videos {
+			got = append(got, v.Index)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GetPlaylistVideosPaged(%d, %d) = %v, want %v", tt.limit, tt.offset, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ limit, offset int }{{-1, 0}, {1, -1}} {
+		if _, err := db.GetPlaylistVideosPaged(id, tt.limit, tt.offset); err == nil {
+			t.Errorf("GetPlaylistVideosPaged(%d, %d) succeeded, want an error", tt.limit, tt.offset)
+		}
+	}
+
+	if n, err := db.CountPlaylistVideos(id); err != nil || n != 5 {
+		t.Errorf("CountPlaylistVideos() = %d, %v, want 5", n, err)
+	}
+	if n, err := db.CountPlaylistVideos("missing"); err != nil || n != 0 {
+		t.Errorf("CountPlaylistVideos(missing) = %d, %v, want 0", n, err)
+	}
+}
+
+func TestExportDownloadsCSV(t *testing.T) {
+	db := newTestDB(t)
+	awkward := insertDownload(t, db, "https://example.com/a?x=1,2", "Title, with \"quotes\"\nand a newline", StatusPending)
+	if err := db.UpdateDownloadChannel(awkward, "Chan,nel"); err != nil {
+		t.Fatalf("UpdateDownloadChannel: %v", err)
+	}
+	if err := db.UpdateDownloadStatus(awkward, StatusFailed, "", "ERROR: line one\nline two"); err != nil {
+		t.Fatalf("UpdateDownloadStatus: %v", err)
+	}
+	plain := insertDownload(t, db, "https://example.com/b", "Plain", StatusCompleted)
+	if err := db.UpdateDownloadFileSize(plain, 2048); err != nil {
+		t.Fatalf("UpdateDownloadFileSize: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := db.ExportDownloadsCSV(&buf); err != nil {
+		t.Fatalf("ExportDownloadsCSV: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("exported CSV doesn't parse: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d rows, want a header and 2 downloads", len(records))
+	}
+
+	header := records[0]
+	column := func(row []string, name string) string {
+		t.Helper()
+		i := slices.Index(header, name)
+		if i < 0 {
+			t.Fatalf("no %q column in %q", name, header)
+		}
+		return row[i]
+	}
+	// Both inserts can share a timestamp, so find each row by its ID
+	rows := map[string][]string{}
+	for _, row := range records[1:] {
+		if len(row) != len(header) {
+			t.Fatalf("row has %d fields, header has %d", len(row), len(header))
+		}
+		rows[column(row, "id")] = row
+	}
+
+	want := map[string]string{
+		"url":     "https://example.com/a?x=1,2",
+		"title":   "Title, with \"quotes\"\nand a newline",
+		"channel": "Chan,nel",
+		"status":  "failed",
+		"error":   "ERROR: line one\nline two",
+	}
+	for name, value := range want {
+		if got := column(rows[awkward], name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if got := column(rows[plain], "file_size"); got != "2048" {
+		t.Errorf("file_size = %q, want 2048", got)
+	}
+	if _, err := time.Parse(time.RFC3339, column(rows[plain], "created_at")); err != nil {
+		t.Errorf("created_at isn't RFC3339: %v", err)
+	}
+}
+
+func TestOpenPragmas(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		pragma string
+		want   string
+	}{
+		{"foreign_keys", "1"},
+		{"journal_mode", "wal"},
+		{"busy_timeout", "5000"},
+	}
+	for _, tt := range tests {
+		var got string
+		if err := db.conn.QueryRow("PRAGMA " + tt.pragma).Scan(&got); err != nil {
+			t.Fatalf("PRAGMA %s: %v", tt.pragma, err)
+		}
+		if got != tt.want {
+			t.Errorf("PRAGMA %s = %s, want %s", tt.pragma, got, tt.want)
+		}
+	}
+}
+
+func TestDeletePlaylistCascades(t *testing.T) {
+	db := newTestDB(t)
+	deleted := insertTestPlaylist(t, db, "https://www.youtube.com/playlist?list=PL1", 3)
+	kept := insertTestPlaylist(t, db, "https://www.youtube.com/playlist?list=PL2", 2)
+
+	if err := db.DeletePlaylist(deleted); err != nil {
+		t.Fatalf("DeletePlaylist: %v", err)
+	}
+	if n, err := db.CountPlaylistVideos(deleted); err != nil || n != 0 {
+		t.Errorf("deleted playlist has %d videos, %v, want 0", n, err)
+	}
+	if n, err := db.CountPlaylistVideos(kept); err != nil || n != 2 {
+		t.Errorf("other playlist has %d videos, %v, want 2", n, err)
+	}
+	if err := db.DeletePlaylist(deleted); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleting it again = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func BenchmarkSaveNewPlaylist(b *testing.B) {
+	db := newTestDB(b)
+	videos := testVideos(1000)
+
+	i := 0
+	for b.Loop() {
+		i++
+		if _, _, err := db.SaveNewPlaylist(fmt.Sprintf("https://www.youtube.com/playlist?list=PL%d", i), "Playlist", "", "", videos); err != nil {
+			b.Fatalf("SaveNewPlaylist: %v", err)
+		}
+	}
+}
+
+func BenchmarkAddPlaylistVideos(b *testing.B) {
+	db := newTestDB(b)
+	videos := testVideos(1000)
+
+	// Half the videos are already saved, as when a playlist is refreshed
+	i := 0
+	for b.Loop() {
+		b.StopTimer()
+		i++
+		playlistID, _, err := db.SaveNewPlaylist(fmt.Sprintf("https://www.youtube.com/playlist?list=PL%d", i), "Playlist", "", "", videos[:len(videos)/2])
+		if err != nil {
+			b.Fatalf("SaveNewPlaylist: %v", err)
+		}
+		b.StartTimer()
+
+		if _, err := db.AddPlaylistVideos(playlistID, videos, len(videos)); err != nil {
+			b.Fatalf("AddPlaylistVideos: %v", err)
+		}
+	}
+}
+
+// Two playlists sharing videos, saved back to back, each keep their own rows
+func TestPlaylistsSharingVideos(t *testing.T) {
+	db := newTestDB(t)
+	first := insertTestPlaylist(t, db, "https://www.youtube.com/playlist?list=PL1", 3)
+	second := insertTestPlaylist(t, db, "https://www.youtube.com/playlist?list=PL2", 3)
+
+	for _, id := range []string{first, second} {
+		videos, err := db.GetPlaylistVideos(id)
+		if err != nil {
+			t.Fatalf("GetPlaylistVideos: %v", err)
+		}
+		if len(videos) != 3 {
+			t.Fatalf("playlist has %d videos, want 3", len(videos))
+		}
+		for _, v := range videos {
+			if v.PlaylistID != id {
+				t.Errorf("video %s belongs to %s, want %s", v.VideoID, v.PlaylistID, id)
+			}
+		}
+		if p, err := db.GetPlaylist(id); err != nil || p.VideosSaved != 3 || p.TotalVideos != 3 {
+			t.Errorf("playlist = %+v, %v, want 3 of 3 videos saved", p, err)
+		}
+	}
+
+	// Re-adding the shared videos to one playlist leaves the other alone
+	added, err := db.AddPlaylistVideos(first, testVideos(4), 4)
+	if err != nil {
+		t.Fatalf("AddPlaylistVideos: %v", err)
+	}
+	if len(added) != 1 || added[0].ID != "video000004" {
+		t.Errorf("added %+v, want only the new video", added)
+	}
+	if n, err := db.CountPlaylistVideos(second); err != nil || n != 3 {
+		t.Errorf("second playlist has %d videos, %v, want 3", n, err)
+	}
+}
+
+// Rows older versions left without a playlist are removed on open
+func TestMigrateRemovesOrphanedPlaylistVideos(t *testing.T) {
+	db := newTestDB(t)
+	id := insertTestPlaylist(t, db, "https://www.youtube.com/playlist?list=PL1", 2)
+
+	ctx := context.Background()
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Foreign keys would stop the orphans from being written at all
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		t.Fatal(err)
+	}
+	for _, playlistID := range []string{"", "deleted-playlist"} {
+		if _, err := conn.ExecContext(ctx,
+			`INSERT INTO playlist_videos (id, playlist_id, video_url, video_title, video_id, channel, channel_url, idx, created_at, updated_at) VALUES (?, ?, '', '', 'video000001', '', '', 1, ?, ?)`,
+			"orphan-"+playlistID, playlistID, time.Now(), time.Now(),
+		); err != nil {
+			t.Fatalf("inserting an orphan: %v", err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if err := db.migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM playlist_videos`).Scan(&total); err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Errorf("%d playlist videos left, want only the playlist's 2", total)
+	}
+	if n, err := db.CountPlaylistVideos(id); err != nil || n != 2 {
+		t.Errorf("playlist has %d videos, %v, want 2", n, err)
+	}
+}
+
+func TestGetDownloadsWithPlaylistBetween(t *testing.T) {
+	db := newTestDB(t)
+	playlistID := insertTestPlaylist(t, db, "https://www.youtube.com/playlist?list=PL1", 1)
+	if _, err := db.InsertDownloadWithPlaylist("https://example.com/in-playlist", "In playlist", playlistID); err != nil {
+		t.Fatalf("InsertDownloadWithPlaylist: %v", err)
+	}
+	insertDownload(t, db, "https://example.com/alone", "Alone", StatusCompleted)
+
+	downloads, err := db.GetDownloadsWithPlaylistBetween(time.Now().Add(-time.Hour), time.Time{})
+	if err != nil {
+		t.Fatalf("GetDownloadsWithPlaylistBetween: %v", err)
+	}
+	titles := map[string]sql.NullString{}
+	for _, d := range downloads {
+		titles[d.Title] = d.PlaylistTitle
+	}
+	if len(downloads) != 2 || titles["In playlist"].String != "Playlist" || titles["Alone"].Valid {
+		t.Errorf("playlist titles = %v, want Playlist for the playlist's download only", titles)
+	}
+
+	if downloads, err := db.GetDownloadsWithPlaylistBetween(time.Time{}, time.Now().Add(-time.Hour)); err != nil || len(downloads) != 0 {
+		t.Errorf("downloads before an hour ago = %d, %v, want none", len(downloads), err)
+	}
+}
@@ -0,0 +1,72 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Sidecar settings, set from -info-json and -keep-info-json. When IngestInfoJSON is set
+// yt-dlp writes a .info.json next to each download, which is read into the database
+// afterwards and then removed unless KeepInfoJSON is set
+var (
+	IngestInfoJSON bool
+	KeepInfoJSON   bool
+)
+
+var infoJSONRegex = regexp.MustCompile(`\[info\] Writing video metadata as JSON to: (.+)`)
+
+// infoJSONFields are the parts of the sidecar stored in the database
+type infoJSONFields struct {
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Categories  []string `json:"categories"`
+}
+
+// infoJSONPath returns where the sidecar of mediaPath is, preferring the path yt-dlp
+// reported writing. Returns empty string if there is none
+func infoJSONPath(reported, mediaPath string) string {
+	candidates := []string{reported}
+	if mediaPath != "" {
+		// yt-dlp names the sidecar after the media file without its extension
+		base := strings.TrimSuffix(mediaPath, filepath.Ext(mediaPath))
+		candidates = append(candidates, base+".info.json")
+	}
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// ingestInfoJSON stores the description, tags and categories of a sidecar for a download,
+// then removes the sidecar unless it's wanted on disk
+func ingestInfoJSON(db *DB, downloadID, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var fields infoJSONFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if err := db.SaveDownloadMetadata(downloadID, fields.Description, fields.Tags, fields.Categories); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+
+	if !KeepInfoJSON {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// logger writes structured logs to the log file; it discards everything until InitLogger is called
+var logger = slog.New(slog.DiscardHandler)
+
+// sensitiveFlags are yt-dlp flags whose values must never be written to the log
+var sensitiveFlags = []string{
+	"--cookies", "--cookies-from-browser",
+	"--username", "-u", "--password", "-p", "--twofactor", "-2", "--video-password",
+	"--ap-username", "--ap-password", "--client-certificate-password",
+}
+
+// ParseLogLevel converts a level name (debug, info, warn, error) to a slog.Level
+func ParseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q (valid: debug, info, warn, error)", level)
+}
+
+// InitLogger opens the log file for appending and routes all logging to it.
+// The returned file must be closed by the caller
+func InitLogger(path string, level slog.Level) (io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	logger = slog.New(slog.NewTextHandler(f, &slog.HandlerOptions{Level: level}))
+	return f, nil
+}
+
+// redactArgs returns a copy of args with the values of sensitive flags replaced
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+
+	for i, arg := range redacted {
+		for _, flag := range sensitiveFlags {
+			short := len(flag) == 2
+			switch {
+			case arg == flag && i+1 < len(redacted):
+				redacted[i+1] = "[REDACTED]"
+			case strings.HasPrefix(arg, flag+"="):
+				redacted[i] = flag + "=[REDACTED]"
+			case short && strings.HasPrefix(arg, flag) && len(arg) > len(flag):
+				// Short flags can have their value glued on, as in -pPASSWORD
+				redacted[i] = flag + "[REDACTED]"
+			}
+		}
+	}
+	return redacted
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writes from pipe readers
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
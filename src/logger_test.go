@@ -0,0 +1,40 @@
+package src
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"no secrets", []string{"-f", "best", "URL"}, []string{"-f", "best", "URL"}},
+		{"long flag", []string{"--password", "hunter2", "URL"}, []string{"--password", "[REDACTED]", "URL"}},
+		{"long flag with =", []string{"--username=alice", "URL"}, []string{"--username=[REDACTED]", "URL"}},
+		{"short flags", []string{"-u", "alice", "-p", "hunter2"}, []string{"-u", "[REDACTED]", "-p", "[REDACTED]"}},
+		{"glued short flag", []string{"-phunter2", "-ualice"}, []string{"-p[REDACTED]", "-u[REDACTED]"}},
+		{"two-factor code", []string{"-2", "123456"}, []string{"-2", "[REDACTED]"}},
+		{"adobe pass", []string{"--ap-username", "alice", "--ap-password=hunter2"}, []string{"--ap-username", "[REDACTED]", "--ap-password=[REDACTED]"}},
+		{"client certificate", []string{"--client-certificate-password", "hunter2"}, []string{"--client-certificate-password", "[REDACTED]"}},
+		{"cookies", []string{"--cookies", "/home/me/cookies.txt"}, []string{"--cookies", "[REDACTED]"}},
+		{"flag at the end", []string{"URL", "--password"}, []string{"URL", "--password"}},
+		{"value looks like a flag", []string{"--password", "-p"}, []string{"--password", "[REDACTED]"}},
+		{"similar long flag", []string{"--paths", "/tmp", "-P", "/tmp"}, []string{"--paths", "/tmp", "-P", "/tmp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := slices.Clone(tt.args)
+			got := redactArgs(args)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("redactArgs(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+			if !slices.Equal(args, tt.args) {
+				t.Errorf("redactArgs modified its input: %q", args)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package src
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// NotifyEnabled turns on desktop notifications when downloads finish
+var NotifyEnabled bool
+
+// Notify shows a desktop notification using notify-send on Linux and osascript on macOS.
+// It does nothing on other platforms
+func Notify(title, body string) error {
+	switch runtime.GOOS {
+	case "linux":
+		return exec.Command("notify-send", "--app-name=ytdlpWrapper", title, body).Run()
+	case "darwin":
+		script := "display notification " + appleScriptString(body) + " with title " + appleScriptString(title)
+		return exec.Command("osascript", "-e", script).Run()
+	}
+	return nil
+}
+
+// OpenFile opens a file or folder with the OS default application: xdg-open on Linux,
+// open on macOS and start on Windows. It doesn't wait for the application to exit
+func OpenFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("xdg-open", path)
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		// The empty argument is start's window title, otherwise a quoted path would be taken as one
+		cmd = exec.Command("cmd", "/c", "start", "", path)
+	default:
+		return fmt.Errorf("opening files is not supported on %s", runtime.GOOS)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// appleScriptString quotes a string for use as an AppleScript literal
+func appleScriptString(s string) string {
+	escaped := make([]rune, 0, len(s)+2)
+	escaped = append(escaped, '"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, r)
+	}
+	return string(append(escaped, '"'))
+}
+
+// notifyDownload sends a notification for a finished download if enabled, based on the
+// status its record ended in and the error it returned.
+// Notification failures are only logged so they never fail the download
+func notifyDownload(title string, status DownloadStatus, err error) {
+	if !NotifyEnabled {
+		return
+	}
+
+	var heading string
+	switch {
+	case err != nil:
+		heading = "Download failed"
+		title += "\n" + err.Error()
+	case status == StatusCompleted:
+		heading = "Download completed"
+	case status == StatusSkipped:
+		heading = "Download skipped"
+	default:
+		return
+	}
+
+	if notifyErr := Notify(heading, title); notifyErr != nil {
+		logger.Debug("failed to send notification", "error", notifyErr)
+	}
+}
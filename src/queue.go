@@ -0,0 +1,141 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DefaultMaxInFlight is how many queued downloads run at once unless configured otherwise
+const DefaultMaxInFlight = 2
+
+// QueueUpdate reports a status change of a queued download
+type QueueUpdate struct {
+	ID      string
+	Status  DownloadStatus
+	Running bool  // Set once the download leaves the queue and starts
+	Err     error // Set with the final status if the download failed
+}
+
+// ErrNotActive is returned when cancelling a download that is neither queued nor running
+var ErrNotActive = errors.New("download is not queued or running")
+
+// Queue runs submitted downloads in the background, at most maxInFlight at a time
+type Queue struct {
+	db        *DB
+	ytdlpArgs []string
+	slots     chan struct{}
+	wg        sync.WaitGroup
+	// silent keeps downloads from writing to the terminal, for a queue running behind the TUI.
+	// Their warnings still go to the log and their outcome to the updates channel
+	silent bool
+
+	mu     sync.Mutex
+	cancel map[string]context.CancelFunc // Queued and running downloads by ID
+}
+
+// NewQueue creates a queue that runs up to maxInFlight downloads at once
+func NewQueue(db *DB, ytdlpArgs []string, maxInFlight int) *Queue {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	return &Queue{
+		db:        db,
+		ytdlpArgs: ytdlpArgs,
+		slots:     make(chan struct{}, maxInFlight),
+		cancel:    make(map[string]context.CancelFunc),
+	}
+}
+
+// Submit records url as a pending download and queues it. An empty format downloads the best available.
+// The returned channel receives the status changes of the download and is closed once it finishes
+func (q *Queue) Submit(url, format string) (string, <-chan QueueUpdate, error) {
+	downloadID, err := createDownload(q.db, url, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Buffered for the running and final updates so nobody has to be listening
+	updates := make(chan QueueUpdate, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q.mu.Lock()
+	q.cancel[downloadID] = cancel
+	q.mu.Unlock()
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		defer close(updates)
+		defer func() {
+			q.mu.Lock()
+			delete(q.cancel, downloadID)
+			q.mu.Unlock()
+			cancel()
+		}()
+
+		select {
+		case q.slots <- struct{}{}:
+		case <-ctx.Done():
+			// Cancelled before it got to run
+			logger.Warn("queued download cancelled", "id", downloadID, "url", url)
+			if err := q.db.UpdateDownloadStatus(downloadID, StatusCancelled, "", "Download cancelled by user"); err != nil {
+				logger.Error("failed to update download status", "id", downloadID, "error", err)
+			}
+			updates <- QueueUpdate{ID: downloadID, Status: StatusCancelled, Err: ErrDownloadCancelled}
+			return
+		}
+		defer func() { <-q.slots }()
+
+		updates <- QueueUpdate{ID: downloadID, Status: StatusPending, Running: true}
+		logger.Info("queued download started", "id", downloadID, "url", url)
+
+		err := executeDownload(ctx, q.db, downloadID, url, format, q.ytdlpArgs, false, downloadOutput{silent: q.silent})
+
+		status := StatusCompleted
+		title := url
+		if d, dbErr := q.db.GetDownload(downloadID); dbErr == nil {
+			status = d.Status
+			if d.Title != "" {
+				title = d.Title
+			}
+		} else if err != nil {
+			status = StatusFailed
+		}
+		if !errors.Is(err, ErrDownloadCancelled) {
+			notifyDownload(title, status, err)
+		}
+		updates <- QueueUpdate{ID: downloadID, Status: status, Err: err}
+	}()
+
+	return downloadID, updates, nil
+}
+
+// CancelDownload cancels a queued or running download, leaving the others untouched.
+// The download is marked cancelled once it has stopped
+func (q *Queue) CancelDownload(id string) error {
+	q.mu.Lock()
+	cancel, ok := q.cancel[id]
+	q.mu.Unlock()
+	if !ok {
+		return ErrNotActive
+	}
+	cancel()
+	return nil
+}
+
+// reserve takes one of the download slots, waiting until one is free or ctx is done.
+// Work that runs downloads outside Submit holds a slot so it stays within the limit
+func (q *Queue) reserve(ctx context.Context) (release func(), ok bool) {
+	select {
+	case q.slots <- struct{}{}:
+		return func() { <-q.slots }, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// Wait blocks until every submitted download has finished
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
@@ -0,0 +1,70 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// A queue behind the TUI must not write to the terminal bubbletea is drawing on
+func TestSilentQueue(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db := newTestDB(t)
+
+	old := Verbose
+	Verbose = true // Verbose output is the chattiest, none of it may get through
+	t.Cleanup(func() { Verbose = old })
+
+	runner := &fakeRunner{
+		// Failing metadata makes the download warn about it
+		run: func(args []string) (string, string, error) {
+			return "", "ERROR: metadata unavailable\n", fakeExitError{code: 1}
+		},
+		stream: func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+			path, _ := filepath.Abs(filepath.Join("downloads", "video.mp4"))
+			if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "[download] Destination: %s\n", path)
+			fmt.Fprintf(stdout, "[download]  50.0%% of   10.00MiB at    2.00MiB/s ETA 00:02\n")
+			fmt.Fprintf(stderr, "WARNING: [youtube] something yt-dlp noticed\n")
+			fmt.Fprintf(stdout, "[download] 100%% of   10.00MiB in 00:00:05 at 2.00MiB/s\n")
+			return nil
+		},
+	}
+	useRunner(t, runner)
+
+	queue := NewQueue(db, []string{"--embed-metadata"}, DefaultMaxInFlight)
+	queue.silent = true
+
+	var final QueueUpdate
+	stdout, stderr := captureOutput(t, func() {
+		for _, url := range []string{"https://www.youtube.com/watch?v=aaaaaaaaaaa", "https://www.youtube.com/watch?v=bbbbbbbbbbb"} {
+			_, updates, err := queue.Submit(url, "")
+			if err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+			for update := range updates {
+				final = update
+			}
+		}
+		queue.Wait()
+	})
+
+	if stdout != "" || stderr != "" {
+		t.Errorf("silent queue printed stdout %q and stderr %q", stdout, stderr)
+	}
+	if final.Status != StatusCompleted || final.Err != nil {
+		t.Errorf("final update = %+v, want completed", final)
+	}
+
+	// The queue's yt-dlp args reach yt-dlp
+	download := runner.calls[len(runner.calls)-1]
+	if !slices.Contains(download, "--embed-metadata") {
+		t.Errorf("download args = %q, want the queue's args passed through", download)
+	}
+}
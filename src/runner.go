@@ -0,0 +1,55 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// Runner runs yt-dlp. Metadata extraction and downloads go through YtdlpRunner, so tests
+// can swap in a fake that returns canned output instead of needing the real binary
+type Runner interface {
+	// Run runs yt-dlp to completion and returns what it wrote to stdout and stderr.
+	// When yt-dlp ran but failed, err is an exitCoder
+	Run(ctx context.Context, args []string) (stdout, stderr []byte, err error)
+	// Stream runs yt-dlp to completion, copying its output to stdout and stderr as it's written
+	Stream(ctx context.Context, args []string, stdout, stderr io.Writer) error
+}
+
+// exitCoder is implemented by the error of a yt-dlp run that exited with an error, such as
+// *exec.ExitError. It tells a failed run, whose output may still be useful, from one that never ran
+type exitCoder interface {
+	ExitCode() int
+}
+
+var _ exitCoder = (*exec.ExitError)(nil)
+
+// YtdlpRunner is the Runner yt-dlp calls go through
+var YtdlpRunner Runner = execRunner{}
+
+// streamWaitDelay is how long Stream keeps reading after yt-dlp exits or is killed.
+// Children such as ffmpeg can hold the pipes open, and reading would otherwise only
+// stop once they exit
+const streamWaitDelay = 2 * time.Second
+
+// execRunner runs the yt-dlp binary found in PATH
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, args []string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+func (execRunner) Stream(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = streamWaitDelay
+	return cmd.Run()
+}
@@ -0,0 +1,441 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRunner answers yt-dlp calls with canned output instead of running it
+type fakeRunner struct {
+	// run answers Run calls and stream answers Stream calls. A nil func fails the call
+	run    func(args []string) (stdout, stderr string, err error)
+	stream func(ctx context.Context, args []string, stdout, stderr io.Writer) error
+
+	mu    sync.Mutex
+	calls [][]string
+}
+
+func (f *fakeRunner) Run(ctx context.Context, args []string) ([]byte, []byte, error) {
+	f.record(args)
+	if f.run == nil {
+		return nil, nil, fakeExitError{code: 2}
+	}
+	stdout, stderr, err := f.run(args)
+	return []byte(stdout), []byte(stderr), err
+}
+
+func (f *fakeRunner) Stream(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	f.record(args)
+	if f.stream == nil {
+		return fakeExitError{code: 2}
+	}
+	return f.stream(ctx, args, stdout, stderr)
+}
+
+func (f *fakeRunner) record(args []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, slices.Clone(args))
+}
+
+// fakeExitError is what a fake yt-dlp run returns when it "exits" with an error
+type fakeExitError struct {
+	code int
+}
+
+func (e fakeExitError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+func (e fakeExitError) ExitCode() int { return e.code }
+
+// useRunner makes r the YtdlpRunner until the test ends
+func useRunner(t *testing.T, r Runner) {
+	t.Helper()
+	old := YtdlpRunner
+	YtdlpRunner = r
+	t.Cleanup(func() { YtdlpRunner = old })
+}
+
+// quiet silences headless progress output until the test ends
+func quiet(t *testing.T) {
+	t.Helper()
+	old := Quiet
+	Quiet = true
+	t.Cleanup(func() { Quiet = old })
+}
+
+const fakeVideoJSON = `{"id": "dQw4w9WgXcQ", "title": "Never Gonna Give You Up", "channel": "Rick Astley",
+	"channel_url": "https://www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw/videos", "duration": 213.0,
+	"upload_date": "20091025", "view_count": 1700000000, "like_count": null}`
+
+func TestExecuteDownload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	quiet(t)
+	db := newTestDB(t)
+
+	const url = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	runner := &fakeRunner{
+		run: func(args []string) (string, string, error) {
+			if !slices.Contains(args, "-J") {
+				return "", "", fmt.Errorf("unexpected metadata call %q", args)
+			}
+			return fakeVideoJSON, "", nil
+		},
+		stream: func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+			path := filepath.Join("downloads", "Never_Gonna_Give_You_Up.mp4")
+			if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+				return err
+			}
+			abs, _ := filepath.Abs(path)
+			fmt.Fprintf(stdout, "[youtube] dQw4w9WgXcQ: Downloading webpage\n")
+			fmt.Fprintf(stdout, "[download] Destination: %s\n", abs)
+			fmt.Fprintf(stdout, "[download]  50.0%% of   10.00MiB at    2.00MiB/s ETA 00:02\n")
+			fmt.Fprintf(stdout, "[download] 100%% of   10.00MiB in 00:00:05 at 2.00MiB/s\n")
+			return nil
+		},
+	}
+	useRunner(t, runner)
+
+	id, err := createDownload(db, url, "")
+	if err != nil {
+		t.Fatalf("createDownload: %v", err)
+	}
+	if err := executeDownload(context.Background(), db, id, url, "", nil, false, downloadOutput{}); err != nil {
+		t.Fatalf("executeDownload: %v", err)
+	}
+
+	d, err := db.GetDownload(id)
+	if err != nil {
+		t.Fatalf("GetDownload: %v", err)
+	}
+	if d.Status != StatusCompleted {
+		t.Errorf("status = %s (%s), want completed", d.Status, d.Error)
+	}
+	if d.Channel != "Rick Astley" || d.Duration != 213 || d.UploadDate != "20091025" || d.VideoID != "dQw4w9WgXcQ" {
+		t.Errorf("metadata = %q, %ds, uploaded %s, video %s", d.Channel, d.Duration, d.UploadDate, d.VideoID)
+	}
+	if d.ChannelURL != "https://www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw" {
+		t.Errorf("channel URL = %q, want it cleaned", d.ChannelURL)
+	}
+	if filepath.Base(d.FilePath) != "Never_Gonna_Give_You_Up.mp4" || d.FileSize != int64(len("video")) {
+		t.Errorf("file = %q (%d bytes)", d.FilePath, d.FileSize)
+	}
+
+	// Metadata first, then the download itself with the URL last
+	if len(runner.calls) != 2 {
+		t.Fatalf("yt-dlp ran %d times, want 2: %q", len(runner.calls), runner.calls)
+	}
+	download := runner.calls[1]
+	if download[len(download)-1] != url || !slices.Contains(download, "--newline") {
+		t.Errorf("download args = %q", download)
+	}
+}
+
+func TestExecuteDownloadFailure(t *testing.T) {
+	t.Chdir(t.TempDir())
+	quiet(t)
+	db := newTestDB(t)
+
+	const url = "https://www.youtube.com/watch?v=xxxxxxxxxxx"
+	useRunner(t, &fakeRunner{
+		run: func(args []string) (string, string, error) {
+			return "", "ERROR: [youtube] xxxxxxxxxxx: Video unavailable\n", fakeExitError{code: 1}
+		},
+		stream: func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+			fmt.Fprintf(stdout, "[youtube] xxxxxxxxxxx: Downloading webpage\n")
+			fmt.Fprintf(stderr, "WARNING: [youtube] Unable to download webpage\n")
+			fmt.Fprintf(stderr, "ERROR: [youtube] xxxxxxxxxxx: Video unavailable\n")
+			return fakeExitError{code: 1}
+		},
+	})
+
+	id, err := createDownload(db, url, "")
+	if err != nil {
+		t.Fatalf("createDownload: %v", err)
+	}
+	err = executeDownload(context.Background(), db, id, url, "", nil, false, downloadOutput{})
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("executeDownload error = %v, want an *ExitError", err)
+	}
+	if got := exitErr.Summary(); got != "ERROR: [youtube] xxxxxxxxxxx: Video unavailable" {
+		t.Errorf("Summary() = %q", got)
+	}
+	if !slices.Contains(exitErr.Stderr, "WARNING: [youtube] Unable to download webpage") {
+		t.Errorf("stderr tail = %q, want the warning too", exitErr.Stderr)
+	}
+
+	d, err := db.GetDownload(id)
+	if err != nil {
+		t.Fatalf("GetDownload: %v", err)
+	}
+	if d.Status != StatusFailed || !strings.Contains(d.Error, "Video unavailable") {
+		t.Errorf("download = %s (%q), want failed with yt-dlp's error", d.Status, d.Error)
+	}
+}
+
+// batchRecord is one --print record of ExtractVideoMetadataBatch's template
+func batchRecord(fields ...string) string {
+	return strings.Join(fields, printFieldSep) + printRecordSep + "\n"
+}
+
+func TestExtractVideoMetadataBatch(t *testing.T) {
+	urls := []string{
+		"https://www.youtube.com/watch?v=aaaaaaaaaaa",
+		"https://www.youtube.com/watch?v=bbbbbbbbbbb",
+		"https://www.youtube.com/watch?v=ccccccccccc",
+		"https://www.youtube.com/watch?v=aaaaaaaaaaa", // Repeated URLs get the same result
+	}
+	// Out of order, with a title full of separators yt-dlp's other templates would trip over
+	output := batchRecord(urls[2], "ccccccccccc", "Chan C", "https://www.youtube.com/@c/videos", "C | title\twith\ttabs", "NA", "NA") +
+		batchRecord(urls[0], "aaaaaaaaaaa", "Chan A", "https://www.youtube.com/@a", "A title", "1234", "56")
+
+	tests := []struct {
+		name    string
+		err     error
+		output  string
+		wantErr bool
+	}{
+		{"success", nil, output, false},
+		// yt-dlp exits non-zero when any URL fails, what it printed is still used
+		{"some URLs failed", fakeExitError{code: 1}, output, false},
+		{"every URL failed", fakeExitError{code: 1}, "", true},
+		{"yt-dlp didn't run", errors.New("exec: \"yt-dlp\": executable file not found in $PATH"), output, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{
+				run: func(args []string) (string, string, error) {
+					return tt.output, "ERROR: [youtube] bbbbbbbbbbb: Private video\n", tt.err
+				},
+			}
+			useRunner(t, runner)
+
+			videos, err := ExtractVideoMetadataBatch(urls)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ExtractVideoMetadataBatch succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractVideoMetadataBatch: %v", err)
+			}
+
+			if len(runner.calls) != 1 || !slices.Contains(runner.calls[0], "--ignore-errors") {
+				t.Fatalf("yt-dlp calls = %q, want a single call with --ignore-errors", runner.calls)
+			}
+			if got := runner.calls[0][len(runner.calls[0])-len(urls):]; !slices.Equal(got, urls) {
+				t.Errorf("yt-dlp got URLs %q, want %q", got, urls)
+			}
+
+			if len(videos) != len(urls) {
+				t.Fatalf("got %d results, want %d", len(videos), len(urls))
+			}
+			a, b, c := videos[0], videos[1], videos[2]
+			if a == nil || a.ID != "aaaaaaaaaaa" || a.Title != "A title" || a.Channel != "Chan A" || a.URL != urls[0] {
+				t.Errorf("first video = %+v", a)
+			}
+			if a != nil && (a.ViewCount == nil || *a.ViewCount != 1234 || a.LikeCount == nil || *a.LikeCount != 56) {
+				t.Errorf("first video counts = %v, %v, want 1234, 56", a.ViewCount, a.LikeCount)
+			}
+			if b != nil {
+				t.Errorf("failed video = %+v, want nil", b)
+			}
+			if c == nil || c.Title != "C | title\twith\ttabs" || c.ChannelURL != "https://www.youtube.com/@c" {
+				t.Errorf("third video = %+v", c)
+			}
+			if c != nil && (c.ViewCount != nil || c.LikeCount != nil) {
+				t.Errorf("third video counts = %v, %v, want nil for NA", c.ViewCount, c.LikeCount)
+			}
+			if videos[3] == nil || videos[3].ID != "aaaaaaaaaaa" {
+				t.Errorf("repeated URL = %+v, want the first video again", videos[3])
+			}
+		})
+	}
+}
+
+func TestExtractPlaylistItems(t *testing.T) {
+	const playlistURL = "https://www.youtube.com/playlist?list=PL123"
+	// Titles that would split a template joined by pipes, tabs or newlines
+	titles := []string{"Part 1 | The Beginning", "Tabs\tin\tthe\ttitle", "Two\nlines", "Plain"}
+
+	var entries []map[string]any
+	var printed strings.Builder
+	for i, title := range titles {
+		id := fmt.Sprintf("video%06d", i+1)
+		url := "https://www.youtube.com/watch?v=" + id
+		entries = append(entries, map[string]any{"id": id, "title": title, "url": url, "playlist_index": i + 1, "channel": "Chan"})
+		printed.WriteString(batchRecord("My | Playlist", "Chan", "https://www.youtube.com/@chan", strconv.Itoa(i+1), id, title, "Chan", "NA", url))
+	}
+	playlistJSON, err := json.Marshal(map[string]any{
+		"title": "My | Playlist", "channel": "Chan", "channel_url": "https://www.youtube.com/@chan", "entries": entries,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		json  string
+		calls int
+	}{
+		{"json", string(playlistJSON), 1},
+		// Unreadable JSON falls back to the --print template
+		{"print fallback", "{not json", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{
+				run: func(args []string) (string, string, error) {
+					if slices.Contains(args, "-J") {
+						return tt.json, "", nil
+					}
+					return printed.String(), "", nil
+				},
+			}
+			useRunner(t, runner)
+
+			info, err := ExtractPlaylistItems(playlistURL, "")
+			if err != nil {
+				t.Fatalf("ExtractPlaylistItems: %v", err)
+			}
+			if len(runner.calls) != tt.calls {
+				t.Errorf("yt-dlp ran %d times, want %d", len(runner.calls), tt.calls)
+			}
+			if info.Title != "My | Playlist" || info.Channel != "Chan" || info.ChannelURL != "https://www.youtube.com/@chan" {
+				t.Errorf("playlist = %q by %q (%s)", info.Title, info.Channel, info.ChannelURL)
+			}
+			if len(info.Videos) != len(titles) {
+				t.Fatalf("got %d videos, want %d", len(info.Videos), len(titles))
+			}
+			for i, v := range info.Videos {
+				if v.Title != titles[i] || v.Index != i+1 || v.ID != fmt.Sprintf("video%06d", i+1) {
+					t.Errorf("video %d = %q (#%d, %s), want %q", i, v.Title, v.Index, v.ID, titles[i])
+				}
+				if v.ChannelURL != "https://www.youtube.com/@chan" {
+					t.Errorf("video %d channel URL = %q, want the playlist's", i, v.ChannelURL)
+				}
+			}
+		})
+	}
+}
+
+// yt-dlp exits successfully for videos a filter rejects or it otherwise doesn't write, these
+// must not end up completed
+func TestExecuteDownloadSkipped(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		reason string
+	}{
+		{
+			"larger than max",
+			"[download] File is larger than max-filesize (52428800 bytes > 1048576 bytes). Aborting.",
+			"File is larger than max-filesize (52428800 bytes > 1048576 bytes). Aborting.",
+		},
+		{
+			"smaller than min",
+			"[download] File is smaller than min-filesize (1024 bytes < 1048576 bytes). Aborting.",
+			"File is smaller than min-filesize (1024 bytes < 1048576 bytes). Aborting.",
+		},
+		{
+			"match filter",
+			"[download] Never Gonna Give You Up does not pass filter (duration < 60), skipping ..",
+			"Never Gonna Give You Up does not pass filter (duration < 60), skipping ..",
+		},
+		{
+			"recorded in the archive",
+			"[download] dQw4w9WgXcQ: Never Gonna Give You Up has already been recorded in the archive",
+			"dQw4w9WgXcQ: Never Gonna Give You Up has already been recorded in the archive",
+		},
+		// No reason given, but no file either
+		{"no destination", "[info] dQw4w9WgXcQ: Downloading 1 format(s): 18", "yt-dlp finished without writing a file"},
+		{"file never written", "[download] Destination: downloads/missing.mp4", "output file not found: downloads/missing.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			quiet(t)
+			db := newTestDB(t)
+
+			const url = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+			useRunner(t, &fakeRunner{
+				run: func(args []string) (string, string, error) {
+					return fakeVideoJSON, "", nil
+				},
+				stream: func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+					fmt.Fprintf(stdout, "[youtube] dQw4w9WgXcQ: Downloading webpage\n")
+					fmt.Fprintln(stdout, tt.output)
+					return nil
+				},
+			})
+
+			id, err := createDownload(db, url, "")
+			if err != nil {
+				t.Fatalf("createDownload: %v", err)
+			}
+			if err := executeDownload(context.Background(), db, id, url, "", nil, false, downloadOutput{}); err != nil {
+				t.Fatalf("executeDownload: %v", err)
+			}
+
+			d, err := db.GetDownload(id)
+			if err != nil {
+				t.Fatalf("GetDownload: %v", err)
+			}
+			if d.Status != StatusSkipped || d.Error != tt.reason || d.FilePath != "" {
+				t.Errorf("download = %s (%q) at %q, want skipped (%q)", d.Status, d.Error, d.FilePath, tt.reason)
+			}
+		})
+	}
+}
+
+// A file left by an earlier run is reported without a Destination line, it still counts
+func TestExecuteDownloadAlreadyOnDisk(t *testing.T) {
+	t.Chdir(t.TempDir())
+	quiet(t)
+	db := newTestDB(t)
+
+	path := filepath.Join("downloads", "Never_Gonna_Give_You_Up.mp4")
+	const url = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	useRunner(t, &fakeRunner{
+		run: func(args []string) (string, string, error) {
+			return fakeVideoJSON, "", nil
+		},
+		stream: func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+			if err := os.WriteFile(path, []byte("earlier"), 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "[download] %s has already been downloaded\n", path)
+			return nil
+		},
+	})
+
+	id, err := createDownload(db, url, "")
+	if err != nil {
+		t.Fatalf("createDownload: %v", err)
+	}
+	if err := executeDownload(context.Background(), db, id, url, "", nil, false, downloadOutput{}); err != nil {
+		t.Fatalf("executeDownload: %v", err)
+	}
+
+	d, err := db.GetDownload(id)
+	if err != nil {
+		t.Fatalf("GetDownload: %v", err)
+	}
+	if d.Status != StatusCompleted || d.FilePath != path || d.FileSize != int64(len("earlier")) {
+		t.Errorf("download = %s (%q) at %q, %d bytes, want completed at %q", d.Status, d.Error, d.FilePath, d.FileSize, path)
+	}
+}
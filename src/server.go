@@ -0,0 +1,276 @@
+package src
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shutdownTimeout bounds how long open HTTP requests get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// SyncInterval makes Serve sync every saved playlist this often, zero disables it
+var SyncInterval time.Duration
+
+// server exposes the download history over HTTP and starts downloads in the background
+type server struct {
+	db    *DB
+	queue *Queue
+}
+
+type downloadRequest struct {
+	URL    string `json:"url"`
+	Format string `json:"format"`
+}
+
+// Serve runs the HTTP API on addr until SIGINT or SIGTERM, then waits for
+// queued and in-flight downloads to finish before returning
+func Serve(addr string, db *DB, ytdlpArgs []string) error {
+	s := &server{db: db, queue: NewQueue(db, ytdlpArgs, DefaultMaxInFlight)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /downloads", s.handleCreateDownload)
+	mux.HandleFunc("GET /downloads", s.handleListDownloads)
+	mux.HandleFunc("GET /downloads/{id}", s.handleGetDownload)
+	mux.HandleFunc("DELETE /downloads/{id}", s.handleCancelDownload)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	infof("Listening on %s\n", addr)
+	logger.Info("server started", "addr", addr)
+
+	syncDone := make(chan struct{})
+	go func() {
+		defer close(syncDone)
+		if SyncInterval > 0 {
+			s.syncLoop(ctx, SyncInterval, ytdlpArgs)
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		stop()
+		<-syncDone
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	infoln("Shutting down, waiting for downloads in progress...")
+	logger.Info("server shutting down")
+	<-syncDone
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to close open connections: %v\n", err)
+	}
+
+	s.queue.Wait()
+	logger.Info("server stopped")
+	return nil
+}
+
+// syncLoop syncs every saved playlist each interval until ctx is done. A run holds one of
+// the queue's download slots, so together with API downloads it stays within the limit
+func (s *server) syncLoop(ctx context.Context, interval time.Duration, ytdlpArgs []string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	infof("Syncing playlists every %s\n", interval)
+	logger.Info("playlist sync scheduled", "interval", interval.String())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		release, ok := s.queue.reserve(ctx)
+		if !ok {
+			return
+		}
+		s.runSync(ytdlpArgs)
+		release()
+	}
+}
+
+// runSync syncs all playlists once and logs what the run downloaded
+func (s *server) runSync(ytdlpArgs []string) {
+	start := time.Now()
+	logger.Info("playlist sync started")
+
+	err := SyncAllPlaylists(s.db, ytdlpArgs)
+
+	var completed, failed int
+	if downloads, dbErr := s.db.GetDownloadsBetween(start, time.Time{}); dbErr == nil {
+		for _, d := range downloads {
+			switch d.Status {
+			case StatusCompleted:
+				completed++
+			case StatusFailed:
+				failed++
+			}
+		}
+	}
+
+	attrs := []any{"downloaded", completed, "failed", failed, "duration", time.Since(start).Round(time.Second).String()}
+	if err != nil {
+		logger.Warn("playlist sync finished with errors", append(attrs, "error", err)...)
+		return
+	}
+	logger.Info("playlist sync finished", attrs...)
+}
+
+func (s *server) handleCreateDownload(w http.ResponseWriter, r *http.Request) {
+	var req downloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	// Downloads are always of a single video, even when opened from a playlist
+	req.URL = SingleVideoURL(strings.TrimSpace(req.URL), true)
+	if req.URL == "" {
+		writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	if err := ValidateURL(req.URL); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if IsPlaylistURL(req.URL) {
+		writeError(w, http.StatusBadRequest, "playlist and channel URLs are not supported")
+		return
+	}
+
+	// Downloads are detached from the request and run to completion even during shutdown
+	downloadID, _, err := s.queue.Submit(req.URL, req.Format)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rec, err := s.db.GetDownload(downloadID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, rec)
+}
+
+// Page sizes for GET /downloads, which takes ?limit=, ?offset=, ?sort= and ?order=
+const (
+	defaultDownloadsLimit = 100
+	maxDownloadsLimit     = 1000
+)
+
+func (s *server) handleListDownloads(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := queryInt(query.Get("limit"), defaultDownloadsLimit)
+	if err != nil || limit < 1 || limit > maxDownloadsLimit {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxDownloadsLimit))
+		return
+	}
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "offset must be 0 or more")
+		return
+	}
+	sortBy, order := query.Get("sort"), query.Get("order")
+	if _, ok := downloadSortColumns[sortBy]; sortBy != "" && !ok {
+		writeError(w, http.StatusBadRequest, "sort must be created_at, title, status or size")
+		return
+	}
+	if order != "" && order != "asc" && order != "desc" {
+		writeError(w, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	downloads, err := s.db.GetDownloadsPaged(limit, offset, sortBy, order)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	total, err := s.db.CountDownloads()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// The body stays a plain array, the total for page math comes as a header
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if downloads == nil {
+		downloads = []DownloadRecord{}
+	}
+	writeJSON(w, http.StatusOK, downloads)
+}
+
+// queryInt parses an integer query parameter, returning def if it's absent
+func queryInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func (s *server) handleGetDownload(w http.ResponseWriter, r *http.Request) {
+	rec, err := s.db.GetDownload(r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "download not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+func (s *server) handleCancelDownload(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := s.queue.CancelDownload(id)
+	if errors.Is(err, ErrNotActive) {
+		if _, dbErr := s.db.GetDownload(id); errors.Is(dbErr, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "download not found")
+			return
+		}
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// The record turns cancelled once yt-dlp has stopped
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": id, "status": "cancelling"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
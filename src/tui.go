@@ -1,8 +1,12 @@
 package src
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -32,14 +36,56 @@ var (
 	infoStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#888888")).
 			MarginBottom(1)
+
+	labelStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#888888")).
+			Width(10)
+
+	errorBoxStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#ff0000")).
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("#ff0000")).
+			Padding(0, 1).
+			Width(76)
 )
 
 type model struct {
-	db          *DB
-	textInput   textinput.Model
-	message     string
-	messageType string // "error" or "success"
-	processing  bool
+	db           *DB
+	queue        *Queue
+	downloading  int // Queued or running downloads
+	textInput    textinput.Model
+	message      string
+	messageType  string // "error" or "success"
+	processing   bool
+	ytdlpChecked bool
+	ytdlpFound   bool
+	ytdlpVersion string
+	ytdlpErr     error
+	ytdlpHint    string
+
+	// Set while asking whether a video opened from a playlist means the video or the playlist
+	choosingPlaylist bool
+	quickDownload    bool // Whether the choice was asked for a tab quick download
+
+	// Set while asking whether to save a large playlist, which isn't saved until confirmed
+	confirmingPlaylist bool
+	pendingPlaylist    *PlaylistInfo
+
+	// History view state. The delete confirmation is shown over the selected download
+	showingHistory   bool
+	history          []DownloadRecord
+	historyCursor    int
+	historyMore      bool // More downloads than loaded, the next page loads when scrolling past the last
+	historyTotal     int
+	historyLoading   bool
+	confirmingDelete bool
+	viewingDownload  bool // Showing the details of the selected download
+
+	// Format picker state, active after a single video URL is entered
+	pickingFormat bool
+	pendingURL    string
+	formats       []Format
+	formatCursor  int
 }
 
 type urlProcessedMsg struct {
@@ -47,53 +93,196 @@ type urlProcessedMsg struct {
 	message string
 }
 
-func processURL(db *DB, url string) tea.Cmd {
+type downloadQueuedMsg struct {
+	url     string
+	updates <-chan QueueUpdate
+}
+
+type downloadUpdateMsg struct {
+	url     string
+	update  QueueUpdate
+	updates <-chan QueueUpdate
+}
+
+// waitForUpdate delivers the next status change of a queued download
+func waitForUpdate(url string, updates <-chan QueueUpdate) tea.Cmd {
+	return func() tea.Msg {
+		update, ok := <-updates
+		if !ok {
+			return nil
+		}
+		return downloadUpdateMsg{url: url, update: update, updates: updates}
+	}
+}
+
+type ytdlpCheckedMsg struct {
+	installed bool
+	version   string
+	err       error
+}
+
+// checkYtdlp looks up the yt-dlp version in the background so startup isn't blocked
+func checkYtdlp() tea.Msg {
+	if !IsInstalled() {
+		return ytdlpCheckedMsg{}
+	}
+	version, err := GetYtdlpVersion()
+	return ytdlpCheckedMsg{installed: true, version: version, err: err}
+}
+
+type formatsFetchedMsg struct {
+	url     string
+	formats []Format
+	err     error
+}
+
+// fetchFormats loads the available formats for the picker
+func fetchFormats(url string) tea.Cmd {
+	return func() tea.Msg {
+		formats, err := GetFormats(url)
+		return formatsFetchedMsg{url: url, formats: formats, err: err}
+	}
+}
+
+// processURL saves a playlist/channel or queues a single video for download in the given format.
+// An empty format downloads the best available
+func processURL(db *DB, queue *Queue, url, format string) tea.Cmd {
 	return func() tea.Msg {
+		if err := ValidateURL(url); err != nil {
+			return urlProcessedMsg{success: false, message: err.Error()}
+		}
+
 		// Determine if it's a playlist/channel or single video
 		if IsPlaylistURL(url) {
-			err := ExtractPlaylistToDB(url, db)
+			if !IsInstalled() {
+				return urlProcessedMsg{
+					success: false,
+					message: "yt-dlp is not installed",
+				}
+			}
+			info, err := ExtractPlaylist(url)
+			if err == nil && len(info.Videos) == 0 {
+				err = fmt.Errorf("no videos found")
+			}
 			if err != nil {
 				return urlProcessedMsg{
 					success: false,
 					message: fmt.Sprintf("Failed to add playlist/channel: %v", err),
 				}
 			}
-			return urlProcessedMsg{
-				success: true,
-				message: "Playlist/Channel added successfully!",
+			// Large playlists wait for confirmation before anything is saved
+			if needsConfirmation(db, url, info) {
+				return playlistExtractedMsg{url: url, info: info}
 			}
+			return savePlaylist(db, url, info)
 		} else {
-			// Single video - download immediately
-			err := RunHeadless(url, []string{}, db)
-			if err != nil {
+			// Single video - skip if it was already downloaded
+			existing, err := db.GetCompletedDownloadByURL(url)
+			if err == nil && existing != nil {
 				return urlProcessedMsg{
 					success: false,
-					message: fmt.Sprintf("Download failed: %v", err),
+					message: fmt.Sprintf("Already downloaded: %s", existing.Title),
 				}
 			}
-			return urlProcessedMsg{
-				success: true,
-				message: "Video downloaded successfully!",
+
+			if !IsInstalled() {
+				return urlProcessedMsg{
+					success: false,
+					message: "yt-dlp is not installed",
+				}
 			}
+
+			return submitDownload(queue, url, format)
+		}
+	}
+}
+
+// submitDownload queues a single video and reports that it was queued
+func submitDownload(queue *Queue, url, format string) tea.Msg {
+	_, updates, err := queue.Submit(url, format)
+	if err != nil {
+		return urlProcessedMsg{
+			success: false,
+			message: fmt.Sprintf("Failed to queue download: %v", err),
+		}
+	}
+	return downloadQueuedMsg{url: url, updates: updates}
+}
+
+type historyLoadedMsg struct {
+	offset    int
+	limit     int
+	downloads []DownloadRecord
+	total     int // Downloads in the whole history
+	err       error
+}
+
+// historyPageSize is how many downloads the history view loads at a time
+const historyPageSize = 100
+
+// loadHistory reads up to limit downloads of the history starting at offset, newest first
+func loadHistory(db *DB, offset, limit int) tea.Cmd {
+	return func() tea.Msg {
+		downloads, err := db.GetDownloadsPaged(limit, offset, "created_at", "desc")
+		if err != nil {
+			return historyLoadedMsg{offset: offset, err: err}
+		}
+		total, err := db.CountDownloads()
+		return historyLoadedMsg{offset: offset, limit: limit, downloads: downloads, total: total, err: err}
+	}
+}
+
+type downloadDeletedMsg struct {
+	id  string
+	err error
+}
+
+// deleteDownload removes a download record from the history
+func deleteDownload(db *DB, id string) tea.Cmd {
+	return func() tea.Msg {
+		return downloadDeletedMsg{id: id, err: db.DeleteDownload(id)}
+	}
+}
+
+type playlistExtractedMsg struct {
+	url  string
+	info *PlaylistInfo
+}
+
+// savePlaylist saves an extracted playlist/channel and reports the result
+func savePlaylist(db *DB, url string, info *PlaylistInfo) tea.Msg {
+	if err := savePlaylistInfo(db, url, info); err != nil {
+		return urlProcessedMsg{
+			success: false,
+			message: fmt.Sprintf("Failed to add playlist/channel: %v", err),
 		}
 	}
+	return urlProcessedMsg{
+		success: true,
+		message: "Playlist/Channel added successfully!",
+	}
 }
 
-func newModel(db *DB) model {
+func newModel(db *DB, ytdlpArgs []string) model {
 	ti := textinput.New()
 	ti.Placeholder = "https://youtube.com/..."
 	ti.Focus()
 	ti.Width = 60
 	ti.CharLimit = 200
 
+	// Bubbletea owns the terminal, downloads report back through the queue's updates instead
+	queue := NewQueue(db, ytdlpArgs, DefaultMaxInFlight)
+	queue.silent = true
+
 	return model{
 		db:        db,
+		queue:     queue,
 		textInput: ti,
 	}
 }
 
 func (m model) Init() tea.Cmd {
-	return textinput.Blink
+	return tea.Batch(textinput.Blink, checkYtdlp)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -101,19 +290,170 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.pickingFormat {
+			return m.updateFormatPicker(msg)
+		}
+		if m.choosingPlaylist {
+			return m.updatePlaylistChoice(msg)
+		}
+		if m.confirmingPlaylist {
+			return m.updatePlaylistConfirm(msg)
+		}
+		if m.showingHistory {
+			return m.updateHistory(msg)
+		}
+
 		switch msg.Type {
 		case tea.KeyCtrlC, tea.KeyEsc:
 			return m, tea.Quit
 
-		case tea.KeyEnter:
-			url := m.textInput.Value()
+		case tea.KeyCtrlO:
+			return m.openDownloadsFolder(), nil
+
+		case tea.KeyCtrlV:
+			return m.pasteURL(), nil
+
+		case tea.KeyCtrlR:
+			m.showingHistory = true
+			m.historyCursor = 0
+			m.historyLoading = true
+			m.message = ""
+			return m, loadHistory(m.db, 0, historyPageSize)
+
+		case tea.KeyEnter, tea.KeyTab:
+			// Tab quick downloads in the best format, skipping the picker
+			url := SingleVideoURL(m.textInput.Value(), false)
 			if url != "" && !m.processing {
+				// Checked before fetching formats, which would fail with a cryptic yt-dlp error
+				if err := ValidateURL(url); err != nil {
+					m.message = err.Error()
+					m.messageType = "error"
+					return m, nil
+				}
 				m.processing = true
-				m.message = "Processing..."
-				m.messageType = "info"
-				return m, processURL(m.db, url)
+				quick := msg.Type == tea.KeyTab
+				if IsWatchWithPlaylist(url) {
+					m.choosingPlaylist = true
+					m.quickDownload = quick
+					m.pendingURL = url
+					m.message = ""
+					return m, nil
+				}
+				return m.submitURL(url, quick, IsPlaylistURL(url))
+			}
+		}
+
+	case formatsFetchedMsg:
+		if msg.err != nil || len(msg.formats) == 0 {
+			// Fall back to the default format rather than blocking the download
+			m.message = "Could not list formats, downloading best..."
+			return m, processURL(m.db, m.queue, msg.url, "")
+		}
+		m.pickingFormat = true
+		m.pendingURL = msg.url
+		m.formats = msg.formats
+		m.formatCursor = 0
+		m.message = ""
+		return m, nil
+
+	case historyLoadedMsg:
+		m.historyLoading = false
+		if !m.showingHistory {
+			return m, nil
+		}
+		if msg.err != nil {
+			if msg.offset == 0 {
+				m.showingHistory = false
+			}
+			m.message = fmt.Sprintf("Failed to load history: %v", msg.err)
+			m.messageType = "error"
+			return m, nil
+		}
+		if msg.offset == 0 {
+			m.history = nil
+		}
+		// Downloads started since the last page shift the rest down, skip the ones already shown
+		seen := make(map[string]bool, len(m.history))
+		for _, d := range m.history {
+			seen[d.ID] = true
+		}
+		for _, d := range msg.downloads {
+			if !seen[d.ID] {
+				m.history = append(m.history, d)
+			}
+		}
+		m.historyMore = len(msg.downloads) == msg.limit
+		m.historyTotal = max(msg.total, len(m.history))
+		m.historyCursor = min(m.historyCursor, max(len(m.history)-1, 0))
+		return m, nil
+
+	case downloadDeletedMsg:
+		if msg.err != nil {
+			m.message = fmt.Sprintf("Failed to delete download: %v", msg.err)
+			m.messageType = "error"
+			return m, nil
+		}
+		for i, d := range m.history {
+			if d.ID == msg.id {
+				m.history = append(m.history[:i], m.history[i+1:]...)
+				m.historyTotal--
+				break
+			}
+		}
+		// Keep the selection on the next download, or the new last one
+		m.historyCursor = min(m.historyCursor, max(len(m.history)-1, 0))
+		m.message = "Download deleted"
+		m.messageType = "success"
+		return m, nil
+
+	case playlistExtractedMsg:
+		m.confirmingPlaylist = true
+		m.pendingURL = msg.url
+		m.pendingPlaylist = msg.info
+		m.message = ""
+		return m, nil
+
+	case ytdlpCheckedMsg:
+		m.ytdlpChecked = true
+		m.ytdlpFound = msg.installed
+		m.ytdlpVersion = msg.version
+		m.ytdlpErr = msg.err
+		m.ytdlpHint = YtdlpUpdateHint(msg.version)
+		return m, nil
+
+	case downloadQueuedMsg:
+		m.processing = false
+		m.downloading++
+		m.message = "Queued: " + msg.url
+		m.messageType = "success"
+		m.textInput.SetValue("")
+		return m, waitForUpdate(msg.url, msg.updates)
+
+	case downloadUpdateMsg:
+		if msg.update.Running {
+			return m, waitForUpdate(msg.url, msg.updates)
+		}
+		m.downloading--
+		switch {
+		case msg.update.Status == StatusCompleted:
+			m.message = "Downloaded: " + msg.url
+			m.messageType = "success"
+		case msg.update.Status == StatusCancelled:
+			m.message = "Cancelled: " + msg.url
+			m.messageType = "error"
+		case msg.update.Status == StatusSkipped:
+			m.message = "Skipped by filter: " + msg.url
+			m.messageType = "error"
+		default:
+			m.message = fmt.Sprintf("Download failed: %v", msg.update.Err)
+			// The status line has room for one line, the full stderr tail is in the history
+			var exitErr *ExitError
+			if errors.As(msg.update.Err, &exitErr) {
+				m.message = "Download failed: " + exitErr.Summary()
 			}
+			m.messageType = "error"
 		}
+		return m, nil
 
 	case urlProcessedMsg:
 		m.processing = false
@@ -131,13 +471,482 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// submitURL saves a playlist, or downloads a video through the format picker unless quick is set
+func (m model) submitURL(url string, quick, playlist bool) (tea.Model, tea.Cmd) {
+	m.messageType = "info"
+	if playlist || quick {
+		m.message = "Processing..."
+		if !playlist {
+			url = NormalizeURL(url)
+		}
+		return m, processURL(m.db, m.queue, url, "")
+	}
+	m.message = "Fetching formats..."
+	return m, fetchFormats(NormalizeURL(url))
+}
+
+// pasteURL replaces the input with the clipboard contents, if they look like a URL
+func (m model) pasteURL() model {
+	text, err := clipboard.ReadAll()
+	if err != nil {
+		m.message = fmt.Sprintf("Couldn't read the clipboard: %v", err)
+		m.messageType = "error"
+		return m
+	}
+
+	text = strings.TrimSpace(text)
+	if err := ValidateURL(text); err != nil {
+		m.message = "The clipboard doesn't contain a URL: " + err.Error()
+		m.messageType = "error"
+		return m
+	}
+
+	m.textInput.SetValue(text)
+	m.textInput.CursorEnd()
+	m.message = ""
+	return m
+}
+
+// openDownloadsFolder opens the downloads folder in the file manager and reports how it went
+func (m model) openDownloadsFolder() model {
+	downloadsDir, err := ensureDownloadsFolder()
+	if err == nil {
+		err = OpenFile(downloadsDir)
+	}
+	if err != nil {
+		m.message = fmt.Sprintf("Couldn't open the downloads folder (%v), it's at ./downloads", err)
+		m.messageType = "error"
+		return m
+	}
+	m.message = "Opened " + downloadsDir
+	m.messageType = "success"
+	return m
+}
+
+// updatePlaylistChoice handles keys while asking what a video opened from a playlist refers to
+func (m model) updatePlaylistChoice(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+
+	case "esc":
+		m.choosingPlaylist = false
+		m.processing = false
+		return m, nil
+
+	case "v":
+		m.choosingPlaylist = false
+		return m.submitURL(m.pendingURL, m.quickDownload, false)
+
+	case "p":
+		m.choosingPlaylist = false
+		return m.submitURL(m.pendingURL, m.quickDownload, true)
+	}
+
+	return m, nil
+}
+
+// updatePlaylistConfirm handles keys while asking whether to save a large playlist.
+// Only y saves it
+func (m model) updatePlaylistConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+
+	case "y", "Y":
+		db, url, info := m.db, m.pendingURL, m.pendingPlaylist
+		m.confirmingPlaylist = false
+		m.pendingPlaylist = nil
+		m.message = "Saving playlist..."
+		m.messageType = "info"
+		return m, func() tea.Msg { return savePlaylist(db, url, info) }
+
+	case "n", "N", "esc", "enter":
+		m.confirmingPlaylist = false
+		m.pendingPlaylist = nil
+		m.processing = false
+		m.message = "Playlist not saved"
+		m.messageType = "info"
+		return m, nil
+	}
+
+	return m, nil
+}
+
+// updateHistory handles keys in the history view and its delete confirmation
+func (m model) updateHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.confirmingDelete {
+		switch msg.String() {
+		case "ctrl+c":
+			return m, tea.Quit
+
+		case "y", "Y":
+			m.confirmingDelete = false
+			if m.historyCursor >= len(m.history) {
+				return m, nil
+			}
+			return m, deleteDownload(m.db, m.history[m.historyCursor].ID)
+
+		case "n", "N", "esc", "enter":
+			m.confirmingDelete = false
+		}
+		return m, nil
+	}
+
+	if m.viewingDownload {
+		return m.updateDownloadDetail(msg)
+	}
+
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+
+	case "enter":
+		if m.historyCursor < len(m.history) {
+			m.viewingDownload = true
+			m.message = ""
+		}
+
+	case "esc", "q":
+		m.showingHistory = false
+		m.history = nil
+		m.message = ""
+		return m, nil
+
+	case "up", "k":
+		if m.historyCursor > 0 {
+			m.historyCursor--
+		}
+
+	case "down", "j":
+		if m.historyCursor < len(m.history)-1 {
+			m.historyCursor++
+		}
+		if m.historyCursor == len(m.history)-1 && m.historyMore && !m.historyLoading {
+			m.historyLoading = true
+			return m, loadHistory(m.db, len(m.history), historyPageSize)
+		}
+
+	case "d", "delete":
+		if m.historyCursor >= len(m.history) {
+			return m, nil
+		}
+		// The queue still writes to records it's downloading
+		if m.history[m.historyCursor].Status == StatusPending {
+			m.message = "Can't delete a download that is still in progress"
+			m.messageType = "error"
+			return m, nil
+		}
+		m.confirmingDelete = true
+		m.message = ""
+	}
+
+	return m, nil
+}
+
+// historyView renders a scrolling window of the download history
+func (m model) historyView() string {
+	const visible = 12
+
+	s := titleStyle.Render("🎬 yt-dlp Wrapper - History")
+	s += "\n\n"
+
+	if len(m.history) == 0 {
+		s += infoStyle.Render("No downloads yet")
+		s += "\n"
+	}
+
+	start := 0
+	if m.historyCursor >= visible {
+		start = m.historyCursor - visible + 1
+	}
+	end := min(start+visible, len(m.history))
+
+	for i := start; i < end; i++ {
+		line := historyLine(m.history[i])
+		if i == m.historyCursor {
+			s += successStyle.UnsetMarginTop().Render("> " + line)
+		} else {
+			s += "  " + line
+		}
+		s += "\n"
+	}
+	if end > start {
+		s += infoStyle.Render(fmt.Sprintf("Showing %d-%d of %d", start+1, end, m.historyTotal))
+		s += "\n"
+	}
+
+	if m.confirmingDelete && m.historyCursor < len(m.history) {
+		s += "\n"
+		s += errorStyle.UnsetMarginTop().Render(fmt.Sprintf("Delete %q from the history? The file is kept. [y/N]", historyTitle(m.history[m.historyCursor])))
+		s += "\n"
+	}
+
+	if m.message != "" {
+		s += "\n"
+		if m.messageType == "error" {
+			s += errorStyle.UnsetMarginTop().Render("✗ " + m.message)
+		} else {
+			s += successStyle.UnsetMarginTop().Render("✓ " + m.message)
+		}
+		s += "\n"
+	}
+
+	s += helpStyle.Render("↑/↓: move • enter: details • d: delete • esc: back")
+
+	return "\n" + s + "\n"
+}
+
+// updateDownloadDetail handles keys on the details of the selected download
+func (m model) updateDownloadDetail(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	d := m.history[m.historyCursor]
+
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+
+	case "esc", "q", "backspace":
+		// Reload so downloads started from the details show up, keeping the pages loaded so far
+		m.viewingDownload = false
+		m.message = ""
+		m.historyLoading = true
+		return m, loadHistory(m.db, 0, max(len(m.history), historyPageSize))
+
+	case "r":
+		if !IsInstalled() {
+			m.message = "yt-dlp is not installed"
+			m.messageType = "error"
+			return m, nil
+		}
+		m.message = "Queueing..."
+		m.messageType = "info"
+		queue, url := m.queue, d.URL
+		return m, func() tea.Msg { return submitDownload(queue, url, "") }
+
+	case "o":
+		if d.FilePath == "" {
+			m.message = "This download has no file"
+			m.messageType = "error"
+			return m, nil
+		}
+		if _, err := os.Stat(d.FilePath); err != nil {
+			m.message = "File not found: " + d.FilePath
+			m.messageType = "error"
+			return m, nil
+		}
+		if err := OpenFile(d.FilePath); err != nil {
+			m.message = fmt.Sprintf("Couldn't open the file: %v", err)
+			m.messageType = "error"
+			return m, nil
+		}
+		m.message = "Opened " + d.FilePath
+		m.messageType = "success"
+
+	case "c":
+		if err := clipboard.WriteAll(d.URL); err != nil {
+			m.message = fmt.Sprintf("Couldn't copy to the clipboard: %v", err)
+			m.messageType = "error"
+			return m, nil
+		}
+		m.message = "Copied URL to the clipboard"
+		m.messageType = "success"
+	}
+
+	return m, nil
+}
+
+// downloadDetailView renders every field of the selected download
+func (m model) downloadDetailView() string {
+	d := m.history[m.historyCursor]
+
+	s := titleStyle.Render("🎬 yt-dlp Wrapper - Download Details")
+	s += "\n\n"
+
+	field := func(label, value string) {
+		if value != "" {
+			s += labelStyle.Render(label) + " " + value + "\n"
+		}
+	}
+	field("Title", d.Title)
+	field("URL", d.URL)
+	field("Channel", d.Channel)
+	field("Status", statusIcon(d.Status)+" "+string(d.Status))
+	field("Path", d.FilePath)
+	if d.FileSize > 0 {
+		field("Size", formatBytes(d.FileSize))
+	}
+	if d.Duration > 0 {
+		field("Duration", formatDuration(d.Duration))
+	}
+	if d.UploadDate != "" {
+		field("Uploaded", formatUploadDate(d.UploadDate))
+	}
+	field("Created", d.CreatedAt.Format("2006-01-02 15:04:05"))
+	field("Updated", d.UpdatedAt.Format("2006-01-02 15:04:05"))
+	field("ID", d.ID)
+
+	// The full error is shown so failures can be diagnosed without the log
+	if d.Error != "" {
+		label := "Error"
+		if d.Status == StatusSkipped {
+			label = "Skipped"
+		}
+		s += "\n"
+		s += errorBoxStyle.Render(label + ": " + strings.TrimSpace(d.Error))
+		s += "\n"
+	}
+
+	if m.message != "" {
+		s += "\n"
+		switch m.messageType {
+		case "error":
+			s += errorStyle.UnsetMarginTop().Render("✗ " + m.message)
+		case "success":
+			s += successStyle.UnsetMarginTop().Render("✓ " + m.message)
+		default:
+			s += infoStyle.UnsetMarginBottom().Render(m.message)
+		}
+		s += "\n"
+	}
+
+	s += helpStyle.Render("r: download again • o: open file • c: copy URL • esc: back")
+
+	return "\n" + s + "\n"
+}
+
+// historyTitle returns the download's title, or its URL when the title isn't known
+func historyTitle(d DownloadRecord) string {
+	if d.Title != "" {
+		return d.Title
+	}
+	return d.URL
+}
+
+// historyLine describes a download in a single line of the history
+func historyLine(d DownloadRecord) string {
+	title := []rune(historyTitle(d))
+	if len(title) > 60 {
+		title = append(title[:59], '…')
+	}
+	return fmt.Sprintf("%s %-60s %s", statusIcon(d.Status), string(title), d.CreatedAt.Format("2006-01-02 15:04"))
+}
+
+// updateFormatPicker handles keys while the format list is shown.
+// Cursor position 0 is the "best" default, followed by the fetched formats
+func (m model) updateFormatPicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+
+	case "esc":
+		m.pickingFormat = false
+		m.processing = false
+		m.message = ""
+		return m, nil
+
+	case "up", "k":
+		if m.formatCursor > 0 {
+			m.formatCursor--
+		}
+
+	case "down", "j":
+		if m.formatCursor < len(m.formats) {
+			m.formatCursor++
+		}
+
+	case "enter", "s":
+		format := ""
+		if msg.String() == "enter" && m.formatCursor > 0 {
+			format = m.formats[m.formatCursor-1].ID
+		}
+		m.pickingFormat = false
+		m.message = "Processing..."
+		m.messageType = "info"
+		return m, processURL(m.db, m.queue, m.pendingURL, format)
+	}
+
+	return m, nil
+}
+
+// formatPickerView renders a scrolling window of the format list
+func (m model) formatPickerView() string {
+	const visible = 12
+
+	s := titleStyle.Render("🎬 yt-dlp Wrapper - Choose Format")
+	s += "\n\n"
+	s += infoStyle.Render(m.pendingURL)
+	s += "\n\n"
+
+	lines := []string{"best (default)"}
+	for _, f := range m.formats {
+		lines = append(lines, formatLine(f))
+	}
+
+	start := 0
+	if m.formatCursor >= visible {
+		start = m.formatCursor - visible + 1
+	}
+	end := start + visible
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	for i := start; i < end; i++ {
+		if i == m.formatCursor {
+			s += successStyle.UnsetMarginTop().Render("> " + lines[i])
+		} else {
+			s += "  " + lines[i]
+		}
+		s += "\n"
+	}
+
+	s += helpStyle.Render("↑/↓: move • enter: download • s: skip (best) • esc: back")
+
+	return "\n" + s + "\n"
+}
+
+// formatLine describes a format in a single line of the picker
+func formatLine(f Format) string {
+	line := fmt.Sprintf("%-8s %-5s %-12s", f.ID, f.Ext, f.Resolution)
+	if f.FPS > 0 {
+		line += fmt.Sprintf(" %3.0ffps", f.FPS)
+	} else {
+		line += "       "
+	}
+
+	codecs := f.VCodec
+	if f.ACodec != "" && f.ACodec != "none" {
+		if codecs == "" || codecs == "none" {
+			codecs = f.ACodec
+		} else {
+			codecs += "+" + f.ACodec
+		}
+	}
+	line += fmt.Sprintf(" %-22s", codecs)
+
+	if f.Filesize > 0 {
+		line += fmt.Sprintf(" %6.1fMiB", float64(f.Filesize)/(1024*1024))
+	}
+	return line
+}
+
 func (m model) View() string {
+	if m.pickingFormat {
+		return m.formatPickerView()
+	}
+	if m.showingHistory && m.viewingDownload {
+		return m.downloadDetailView()
+	}
+	if m.showingHistory {
+		return m.historyView()
+	}
+
 	s := titleStyle.Render("🎬 yt-dlp Wrapper - Add URL")
 	s += "\n\n"
 
 	s += infoStyle.Render("Enter a YouTube URL:")
 	s += "\n"
-	s += infoStyle.Render("• Single video → downloads immediately")
+	s += infoStyle.Render("• Single video → pick a format and queue the download")
 	s += "\n"
 	s += infoStyle.Render("• Playlist/Channel → saves to database")
 	s += "\n\n"
@@ -145,6 +954,22 @@ func (m model) View() string {
 	s += m.textInput.View()
 	s += "\n"
 
+	if m.choosingPlaylist {
+		s += "\n"
+		s += infoStyle.Render("This video was opened from a playlist.")
+		s += "\n"
+		s += helpStyle.UnsetMarginTop().Render("v: just this video • p: whole playlist • esc: back")
+		s += "\n"
+	}
+
+	if m.confirmingPlaylist {
+		s += "\n"
+		s += infoStyle.Render(fmt.Sprintf("This playlist has %s videos. Save all? [y/N]", formatThousands(len(m.pendingPlaylist.Videos))))
+		s += "\n"
+		s += helpStyle.UnsetMarginTop().Render("y: save • n/enter/esc: cancel")
+		s += "\n"
+	}
+
 	if m.message != "" {
 		s += "\n"
 		switch m.messageType {
@@ -157,12 +982,40 @@ func (m model) View() string {
 		}
 	}
 
+	if m.downloading > 0 {
+		s += "\n"
+		s += infoStyle.UnsetMarginBottom().Render(fmt.Sprintf("%d download(s) in progress", m.downloading))
+	}
+
 	s += "\n"
-	s += helpStyle.Render("enter: submit • esc/ctrl+c: quit")
+	s += m.statusLine()
+
+	s += "\n"
+	s += helpStyle.Render("enter: submit • tab: quick download • ctrl+v: paste URL • ctrl+r: history • ctrl+o: open downloads • esc/ctrl+c: quit")
 
 	return "\n" + s + "\n"
 }
 
-func NewProgram(db *DB) *tea.Program {
-	return tea.NewProgram(newModel(db))
+// statusLine describes the yt-dlp installation state
+func (m model) statusLine() string {
+	if !m.ytdlpChecked {
+		return helpStyle.Render("Checking yt-dlp...")
+	}
+	if !m.ytdlpFound {
+		return errorStyle.Render("✗ yt-dlp is not installed")
+	}
+	if m.ytdlpErr != nil {
+		return helpStyle.Render("yt-dlp is installed (version unknown)")
+	}
+
+	s := helpStyle.Render(fmt.Sprintf("yt-dlp is installed (%s)", m.ytdlpVersion))
+	if m.ytdlpHint != "" {
+		s += "\n" + infoStyle.Render(m.ytdlpHint)
+	}
+	return s
+}
+
+// NewProgram creates the TUI. Its downloads get ytdlpArgs passed through to yt-dlp
+func NewProgram(db *DB, ytdlpArgs []string) *tea.Program {
+	return tea.NewProgram(newModel(db, ytdlpArgs))
 }
@@ -0,0 +1,90 @@
+package src
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// packageManagers maps install locations of package-managed yt-dlp binaries to the
+// manager's name and update command. 'yt-dlp -U' refuses to update these
+var packageManagers = []struct {
+	prefix  string
+	name    string
+	command string
+}{
+	{"/opt/homebrew/", "Homebrew", "brew upgrade yt-dlp"},
+	{"/usr/local/Cellar/", "Homebrew", "brew upgrade yt-dlp"},
+	{"/home/linuxbrew/", "Homebrew", "brew upgrade yt-dlp"},
+	{"/nix/store/", "Nix", "update it through your Nix configuration"},
+	{"/snap/", "Snap", "sudo snap refresh yt-dlp"},
+	{"/usr/bin/", "your system package manager", "e.g. sudo apt upgrade yt-dlp or sudo dnf upgrade yt-dlp"},
+}
+
+// UpdateYtdlp updates yt-dlp with 'yt-dlp -U', falling back to pip for pip installs,
+// and reports the version before and after. Package-managed installs only get guidance
+func UpdateYtdlp() error {
+	path, err := exec.LookPath("yt-dlp")
+	if err != nil {
+		return fmt.Errorf("yt-dlp is not installed")
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	before, err := GetYtdlpVersion()
+	if err != nil {
+		before = "unknown"
+	}
+	fmt.Printf("Current yt-dlp version: %s (%s)\n", before, path)
+
+	for _, pm := range packageManagers {
+		if strings.HasPrefix(path, pm.prefix) {
+			fmt.Printf("yt-dlp was installed with %s, which has to update it: %s\n", pm.name, pm.command)
+			return nil
+		}
+	}
+
+	if err := runUpdateCommand("yt-dlp", "-U"); err != nil {
+		pip := findPip()
+		if pip == "" {
+			return fmt.Errorf("yt-dlp -U failed: %w", err)
+		}
+		fmt.Println("yt-dlp -U failed, trying pip...")
+		if err := runUpdateCommand(pip, "install", "-U", "yt-dlp"); err != nil {
+			return fmt.Errorf("failed to update yt-dlp with pip: %w", err)
+		}
+	}
+
+	after, err := GetYtdlpVersion()
+	if err != nil {
+		return fmt.Errorf("failed to check the updated version: %w", err)
+	}
+
+	if after == before {
+		fmt.Printf("yt-dlp is up to date (%s)\n", after)
+	} else {
+		fmt.Printf("Updated yt-dlp: %s → %s\n", before, after)
+	}
+	return nil
+}
+
+// runUpdateCommand runs an update command with its output shown to the user
+func runUpdateCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// findPip returns the first pip executable on PATH, or empty string if there is none
+func findPip() string {
+	for _, name := range []string{"pip3", "pip"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
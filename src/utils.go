@@ -1,7 +1,15 @@
 package src
 
 import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // CleanChannelURL removes common suffixes and query parameters from channel URLs
@@ -38,19 +46,615 @@ func CleanChannelURL(urlStr string) string {
 	return urlStr
 }
 
-// IsChannelURL checks if a URL is a channel URL
+// parseURL parses a URL, assuming https:// when the scheme is left out (e.g. "youtube.com/@name")
+func parseURL(urlStr string) (*url.URL, error) {
+	urlStr = strings.TrimSpace(urlStr)
+	if !strings.Contains(urlStr, "://") {
+		urlStr = "https://" + urlStr
+	}
+	return url.Parse(urlStr)
+}
+
+// searchPrefixRegex matches yt-dlp search prefixes such as ytsearch:, ytsearch5: or ytsearchall:
+var searchPrefixRegex = regexp.MustCompile(`^ytsearch(\d+|all)?:`)
+
+// SearchQuery returns the query of a yt-dlp search such as "ytsearch:lofi mix" or
+// "ytsearch5:lofi mix", and whether s is one
+func SearchQuery(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	prefix := searchPrefixRegex.FindString(s)
+	if prefix == "" {
+		return "", false
+	}
+	return strings.TrimSpace(s[len(prefix):]), true
+}
+
+// videoIDRegex matches a bare YouTube video ID
+var videoIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// ValidateURL checks that s is an http(s) URL with a host, or a yt-dlp ytsearch: query.
+// As everywhere else, the scheme may be left out
+func ValidateURL(s string) error {
+	s = strings.TrimSpace(s)
+	if prefix := searchPrefixRegex.FindString(s); prefix != "" {
+		if strings.TrimSpace(s[len(prefix):]) == "" {
+			return fmt.Errorf("the search query is empty")
+		}
+		return nil
+	}
+
+	parsed, err := parseURL(s)
+	if err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") &&
+		(strings.Contains(parsed.Hostname(), ".") || parsed.Hostname() == "localhost") {
+		return nil
+	}
+	if videoIDRegex.MatchString(s) {
+		return fmt.Errorf("%q looks like a video ID, use https://youtu.be/%s instead", s, s)
+	}
+	return fmt.Errorf("%q doesn't look like a valid URL", s)
+}
+
+// pathSegments splits a URL path into its non-empty segments
+func pathSegments(parsed *url.URL) []string {
+	var segments []string
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// ChannelIDFromURL returns the channel ID (UC...) of a youtube.com/channel/ID URL, or "" for
+// any other URL. Handles and /c/ or /user/ names can only be resolved by asking yt-dlp
+func ChannelIDFromURL(urlStr string) string {
+	parsed, err := parseURL(urlStr)
+	if err != nil {
+		return ""
+	}
+	switch youtubeHost(parsed) {
+	case "youtube.com", "music.youtube.com":
+	default:
+		return ""
+	}
+	segments := pathSegments(parsed)
+	if len(segments) >= 2 && strings.ToLower(segments[0]) == "channel" {
+		return segments[1]
+	}
+	return ""
+}
+
+// IsChannelURL checks if a URL is a YouTube channel URL: /@handle, /channel/ID, /c/name or /user/name,
+// optionally followed by a tab such as /videos
 func IsChannelURL(urlStr string) bool {
-	return strings.Contains(urlStr, "/channel/") ||
-		strings.Contains(urlStr, "/@") ||
-		strings.Contains(urlStr, "/c/") ||
-		strings.Contains(urlStr, "/user/")
+	parsed, err := parseURL(urlStr)
+	if err != nil {
+		return false
+	}
+
+	switch youtubeHost(parsed) {
+	case "youtube.com", "music.youtube.com":
+	default:
+		return false
+	}
+
+	segments := pathSegments(parsed)
+	if len(segments) == 0 {
+		return false
+	}
+	if strings.HasPrefix(segments[0], "@") {
+		return len(segments[0]) > 1
+	}
+	switch strings.ToLower(segments[0]) {
+	case "channel", "c", "user":
+		return len(segments) > 1
+	}
+	return false
 }
 
-// IsPlaylistURL checks if a URL is a playlist or channel URL
+// IsPlaylistURL checks if a URL is a playlist or channel URL. On YouTube that is a list=
+// query parameter or a channel path. Other sites are recognised by a /playlist or /playlists
+// path segment only
 func IsPlaylistURL(urlStr string) bool {
-	// Check for common playlist and channel indicators
-	return strings.Contains(urlStr, "/playlist") ||
-		strings.Contains(urlStr, "list=") ||
-		strings.Contains(urlStr, "/playlists/") ||
-		IsChannelURL(urlStr)
+	parsed, err := parseURL(urlStr)
+	if err != nil {
+		return false
+	}
+
+	switch youtubeHost(parsed) {
+	case "youtube.com", "music.youtube.com":
+		return parsed.Query().Get("list") != "" || IsChannelURL(urlStr)
+	case "youtu.be":
+		return parsed.Query().Get("list") != ""
+	}
+
+	for _, segment := range pathSegments(parsed) {
+		switch strings.ToLower(segment) {
+		case "playlist", "playlists":
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeURL maps the many forms of a YouTube video URL (youtu.be/X, /shorts/X, /embed/X,
+// /live/X, watch?v=X&t=10&list=Y, with or without www. or a scheme) to
+// https://www.youtube.com/watch?v=X, so the same video always maps to the same URL.
+// Playlist pages map to https://www.youtube.com/playlist?list=X the same way.
+// Other URLs only lose their #fragment
+func NormalizeURL(urlStr string) string {
+	if _, ok := SearchQuery(urlStr); ok {
+		return urlStr
+	}
+	parsed, err := parseURL(urlStr)
+	if err != nil {
+		return urlStr
+	}
+
+	if videoID := youtubeVideoID(parsed); videoID != "" {
+		return "https://www.youtube.com/watch?v=" + videoID
+	}
+	if listID := youtubePlaylistID(parsed); listID != "" {
+		return "https://www.youtube.com/playlist?list=" + listID
+	}
+	if i := strings.Index(urlStr, "#"); i >= 0 {
+		return strings.TrimSpace(urlStr[:i])
+	}
+	return urlStr
+}
+
+// YouTubeVideoID returns the ID of the video a YouTube URL opens, or "" if it isn't a YouTube video URL
+func YouTubeVideoID(urlStr string) string {
+	parsed, err := parseURL(urlStr)
+	if err != nil {
+		return ""
+	}
+	return youtubeVideoID(parsed)
+}
+
+// youtubeVideoID returns the ID of the video a YouTube URL opens, or "" if it isn't a video URL
+func youtubeVideoID(parsed *url.URL) string {
+	segments := pathSegments(parsed)
+	switch youtubeHost(parsed) {
+	case "youtube.com", "music.youtube.com":
+		if len(segments) == 1 && segments[0] == "watch" {
+			return parsed.Query().Get("v")
+		}
+		if len(segments) == 2 {
+			switch segments[0] {
+			case "shorts", "embed", "live", "v":
+				if videoIDRegex.MatchString(segments[1]) {
+					return segments[1]
+				}
+			}
+		}
+	case "youtube-nocookie.com":
+		if len(segments) == 2 && segments[0] == "embed" && videoIDRegex.MatchString(segments[1]) {
+			return segments[1]
+		}
+	case "youtu.be":
+		if len(segments) == 1 && videoIDRegex.MatchString(segments[0]) {
+			return segments[0]
+		}
+	}
+	return ""
+}
+
+// youtubePlaylistID returns the list ID of a YouTube playlist page URL, or "" if it isn't one
+func youtubePlaylistID(parsed *url.URL) string {
+	switch youtubeHost(parsed) {
+	case "youtube.com", "music.youtube.com":
+		if segments := pathSegments(parsed); len(segments) == 1 && segments[0] == "playlist" {
+			return parsed.Query().Get("list")
+		}
+	}
+	return ""
+}
+
+// youtubeHost returns the host of a parsed URL without the www. and m. prefixes
+func youtubeHost(parsed *url.URL) string {
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	return strings.TrimPrefix(host, "m.")
+}
+
+// IsWatchWithPlaylist checks if a YouTube URL opens a single video from a playlist or mix,
+// e.g. youtube.com/watch?v=X&list=Y
+func IsWatchWithPlaylist(urlStr string) bool {
+	parsed, err := parseURL(urlStr)
+	if err != nil {
+		return false
+	}
+
+	query := parsed.Query()
+	if query.Get("list") == "" {
+		return false
+	}
+
+	switch youtubeHost(parsed) {
+	case "youtube.com", "music.youtube.com":
+		return parsed.Path == "/watch" && query.Get("v") != ""
+	case "youtu.be":
+		return strings.Trim(parsed.Path, "/") != ""
+	}
+	return false
+}
+
+// IsMixURL checks if a URL's list is a YouTube mix (list=RD...). Mixes are generated
+// around a video and endless, unlike real playlists
+func IsMixURL(urlStr string) bool {
+	parsed, err := parseURL(urlStr)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(parsed.Query().Get("list"), "RD")
+}
+
+// SingleVideoURL returns just the video of a URL that opens it from a playlist or mix when
+// only the video is wanted: with noPlaylist set, or always for mixes. Other URLs are returned unchanged
+func SingleVideoURL(urlStr string, noPlaylist bool) string {
+	if IsWatchWithPlaylist(urlStr) && (noPlaylist || IsMixURL(urlStr)) {
+		return NormalizeURL(urlStr)
+	}
+	return urlStr
+}
+
+// thumbnailContainers lists the output formats yt-dlp can embed cover art into
+var thumbnailContainers = map[string]bool{
+	"mp3": true, "mkv": true, "mka": true, "ogg": true, "opus": true,
+	"flac": true, "m4a": true, "mp4": true, "m4v": true, "mov": true,
+}
+
+// ArgValue returns the value following a flag in an args list, or "" if absent.
+// Both "--flag value" and "--flag=value" forms are recognised.
+func ArgValue(args []string, flag string) string {
+	for i, arg := range args {
+		if arg == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, flag+"=") {
+			return strings.TrimPrefix(arg, flag+"=")
+		}
+	}
+	return ""
+}
+
+// HasArg checks if a flag is present in an args list
+func HasArg(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// ThumbnailEmbedWarning returns a warning if the requested output format can't hold a thumbnail.
+// Returns empty string when the format is supported or unknown
+func ThumbnailEmbedWarning(args []string) string {
+	for _, flag := range []string{"--audio-format", "--merge-output-format", "--remux-video", "--recode-video"} {
+		format := strings.ToLower(ArgValue(args, flag))
+		if format == "" || format == "best" {
+			continue
+		}
+		if !thumbnailContainers[format] {
+			return fmt.Sprintf("format %q does not support embedded thumbnails", format)
+		}
+	}
+	return ""
+}
+
+// mergeContainers lists the containers -container accepts, with the codecs each can't hold.
+// Codecs are matched by the names yt-dlp uses in format selectors and sort fields
+var mergeContainers = map[string][]string{
+	"mp4":  {"vp8", "vp9", "vp09", "vorbis", "opus"},
+	"webm": {"avc", "h264", "h265", "hevc", "aac", "mp4a"},
+	"mkv":  nil,
+}
+
+// ValidateContainer checks a -container value
+func ValidateContainer(container string) error {
+	if _, ok := mergeContainers[container]; !ok {
+		return fmt.Errorf("unsupported container %q (expected mp4, mkv or webm)", container)
+	}
+	return nil
+}
+
+// ContainerCodecWarning returns a warning if the format selection (-f) or --format-sort in args
+// asks for a codec the container can't hold. Returns empty string when no conflict is seen
+func ContainerCodecWarning(container string, args []string) string {
+	selection := strings.ToLower(ArgValue(args, "-f") + " " + ArgValue(args, "--format") + " " + ArgValue(args, "--format-sort"))
+	for _, codec := range mergeContainers[container] {
+		if strings.Contains(selection, codec) {
+			return fmt.Sprintf("%s can't hold %s, yt-dlp may fail to merge or pick other formats; mkv holds any codec", container, codec)
+		}
+	}
+	return ""
+}
+
+// cookieBrowsers lists the browsers yt-dlp can read cookies from
+var cookieBrowsers = map[string]bool{
+	"brave": true, "chrome": true, "chromium": true, "edge": true, "firefox": true,
+	"opera": true, "safari": true, "vivaldi": true, "whale": true,
+}
+
+// ValidateCookiesBrowser checks that a --cookies-from-browser value names a supported browser.
+// The yt-dlp BROWSER[+KEYRING][:PROFILE][::CONTAINER] syntax is accepted
+func ValidateCookiesBrowser(spec string) error {
+	name := spec
+	if idx := strings.IndexAny(name, "+:"); idx != -1 {
+		name = name[:idx]
+	}
+	name = strings.ToLower(name)
+
+	if !cookieBrowsers[name] {
+		browsers := make([]string, 0, len(cookieBrowsers))
+		for browser := range cookieBrowsers {
+			browsers = append(browsers, browser)
+		}
+		sort.Strings(browsers)
+		return fmt.Errorf("unsupported cookies browser %q (supported: %s)", name, strings.Join(browsers, ", "))
+	}
+	return nil
+}
+
+// ValidateCookiesFile checks that a cookies file exists and is a regular file
+func ValidateCookiesFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("cookies file %s does not exist", path)
+		}
+		return fmt.Errorf("failed to read cookies file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cookies file %s is a directory", path)
+	}
+	return nil
+}
+
+// sponsorBlockCategories lists the SponsorBlock segment categories yt-dlp understands
+var sponsorBlockCategories = []string{
+	"all", "default", "sponsor", "intro", "outro", "selfpromo", "preview",
+	"filler", "interaction", "music_offtopic", "poi_highlight", "chapter",
+}
+
+// ValidateSponsorBlockCategories checks a comma-separated category list.
+// Categories may be prefixed with "-" to exclude them; poi_highlight and chapter
+// can only be marked, not removed
+func ValidateSponsorBlockCategories(cats string, remove bool) error {
+	if strings.TrimSpace(cats) == "" {
+		return fmt.Errorf("no SponsorBlock categories given")
+	}
+
+	for _, cat := range strings.Split(cats, ",") {
+		cat = strings.TrimPrefix(strings.TrimSpace(cat), "-")
+
+		known := false
+		for _, c := range sponsorBlockCategories {
+			if cat == c {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown SponsorBlock category %q (valid: %s)", cat, strings.Join(sponsorBlockCategories, ", "))
+		}
+		if remove && (cat == "poi_highlight" || cat == "chapter") {
+			return fmt.Errorf("SponsorBlock category %q can only be marked, not removed", cat)
+		}
+	}
+	return nil
+}
+
+// formatSortFields lists the fields yt-dlp's --format-sort understands
+var formatSortFields = []string{
+	"hasvid", "hasaud", "ie_pref", "lang", "quality", "source", "proto", "vcodec", "acodec",
+	"codec", "vext", "aext", "ext", "filesize", "fs_approx", "size", "height", "width",
+	"res", "fps", "hdr", "channels", "tbr", "vbr", "abr", "br", "asr", "id",
+}
+
+// ValidateFormatSort checks a --format-sort spec such as "res:1080,vcodec:av01,+size".
+// Each field may be prefixed with "+" to reverse it and followed by :VALUE or ~VALUE
+func ValidateFormatSort(spec string) error {
+	if strings.TrimSpace(spec) == "" {
+		return fmt.Errorf("no format sort fields given")
+	}
+
+	for _, field := range strings.Split(spec, ",") {
+		name := strings.TrimPrefix(strings.TrimSpace(field), "+")
+		if i := strings.IndexAny(name, ":~"); i >= 0 {
+			if i == len(name)-1 {
+				return fmt.Errorf("format sort field %q has no value", field)
+			}
+			name = name[:i]
+		}
+
+		known := false
+		for _, f := range formatSortFields {
+			if name == f {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown format sort field %q (valid: %s)", name, strings.Join(formatSortFields, ", "))
+		}
+	}
+	return nil
+}
+
+// IsYouTubeURL checks if a URL points to a YouTube host
+func IsYouTubeURL(urlStr string) bool {
+	parsed, err := parseURL(urlStr)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	return host == "youtu.be" || host == "youtube.com" || strings.HasSuffix(host, ".youtube.com")
+}
+
+// DefaultArchivePath is where the yt-dlp download archive lives unless overridden
+var DefaultArchivePath = filepath.Join("downloads", "archive.txt")
+
+// EnsureArchiveFile creates the download archive (and its folder) if it doesn't exist yet
+func EnsureArchiveFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// rateLimitRegex matches yt-dlp rate values such as 500K, 4.2M or 1048576
+var rateLimitRegex = regexp.MustCompile(`(?i)^\d+(\.\d+)?[KMGTPEZY]?$`)
+
+// ValidateRateLimit checks that a --limit-rate value is in a format yt-dlp accepts.
+// The limit applies per yt-dlp process, so N concurrent downloads can use up to N times the rate
+func ValidateRateLimit(rate string) error {
+	if !rateLimitRegex.MatchString(rate) {
+		return fmt.Errorf("invalid rate limit %q (expected a number with an optional K/M/G suffix, e.g. 500K or 2M)", rate)
+	}
+	return nil
+}
+
+// sizeRegex matches file sizes such as 500K, 1.5G, 200MB or 1048576
+var sizeRegex = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*([KMG]?)(?:i?B)?$`)
+
+// ParseSize converts a size with an optional K/M/G suffix to bytes, using 1024 multiples like yt-dlp
+func ParseSize(size string) (int64, error) {
+	matches := sizeRegex.FindStringSubmatch(strings.TrimSpace(size))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid size %q (expected a number with an optional K/M/G suffix, e.g. 500M or 2G)", size)
+	}
+	n, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", size, err)
+	}
+	switch strings.ToUpper(matches[2]) {
+	case "K":
+		n *= 1 << 10
+	case "M":
+		n *= 1 << 20
+	case "G":
+		n *= 1 << 30
+	}
+	return int64(n), nil
+}
+
+var dayWeekRegex = regexp.MustCompile(`(\d+(?:\.\d+)?)([dw])`)
+
+// ParseDuration is time.ParseDuration plus d (24h) and w (7d) units, which can be combined
+// with the standard ones, e.g. 90m, 7d, 2w or 1d12h
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	expanded := dayWeekRegex.ReplaceAllStringFunc(s, func(part string) string {
+		m := dayWeekRegex.FindStringSubmatch(part)
+		n, _ := strconv.ParseFloat(m[1], 64)
+		hours := n * 24
+		if m[2] == "w" {
+			hours *= 7
+		}
+		return strconv.FormatFloat(hours, 'f', -1, 64) + "h"
+	})
+	d, err := time.ParseDuration(expanded)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (expected e.g. 90m, 12h, 7d or 2w)", s)
+	}
+	return d, nil
+}
+
+// dateLayouts are the absolute date formats accepted by ParseTimeBound
+var dateLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04:05", time.RFC3339}
+
+// ParseTimeBound parses either an absolute date (2024-01-01, 2024-01-01 15:04, RFC 3339) in local
+// time or a duration relative to now (72h, 7d, 2w), which means that long before now.
+// dateOnly reports whether s was a plain date, so callers can treat it as a whole day
+func ParseTimeBound(s string, now time.Time) (t time.Time, dateOnly bool, err error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, layout == dateLayouts[0], nil
+		}
+	}
+
+	d, err := ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, false, fmt.Errorf("invalid time %q (expected a date like 2024-01-01 or a duration like 72h or 7d)", s)
+	}
+	return now.Add(-d), false, nil
+}
+
+// ValidateMatchFilter checks that a --match-filter expression is non-empty and has balanced quotes,
+// e.g. "duration > 600 & view_count > 1000" or "title ~= '(?i)live'"
+func ValidateMatchFilter(filter string) error {
+	if strings.TrimSpace(filter) == "" {
+		return fmt.Errorf("empty match filter")
+	}
+	var quote rune
+	escaped := false
+	for _, r := range filter {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		}
+	}
+	if quote != 0 {
+		return fmt.Errorf("invalid match filter %q: unterminated %c quote", filter, quote)
+	}
+	return nil
+}
+
+// playlistItemRegex matches one --playlist-items entry: an index (1, -1), a range (1-10)
+// or a slice (50:, 1:10:2)
+var playlistItemRegex = regexp.MustCompile(`^(-?\d+(-\d+)?|-?\d*:-?\d*(:-?\d+)?)$`)
+
+// ValidatePlaylistItems checks a comma-separated --playlist-items spec such as "1-10,15,50:"
+func ValidatePlaylistItems(spec string) error {
+	if strings.TrimSpace(spec) == "" {
+		return fmt.Errorf("empty playlist items spec")
+	}
+	for _, item := range strings.Split(spec, ",") {
+		if !playlistItemRegex.MatchString(strings.TrimSpace(item)) {
+			return fmt.Errorf("invalid playlist item %q (expected e.g. 1-10, 1,3,5 or 50:)", item)
+		}
+	}
+	return nil
+}
+
+// DefaultOutputTemplate is the yt-dlp filename template used inside the downloads folder
+const DefaultOutputTemplate = "%(title)s.%(ext)s"
+
+// chapterOutputTemplate names the files --split-chapters writes, inside the downloads folder
+const chapterOutputTemplate = "%(title)s - %(section_number)03d %(section_title)s.%(ext)s"
+
+// OutputTemplate is the filename template downloads are saved with, relative to the downloads folder
+var OutputTemplate = DefaultOutputTemplate
+
+// SetOutputTemplate validates and sets the filename template for downloads.
+// Templates may create subfolders but must stay inside the downloads folder
+func SetOutputTemplate(tmpl string) error {
+	if strings.TrimSpace(tmpl) == "" {
+		return fmt.Errorf("output template is empty")
+	}
+	if filepath.IsAbs(tmpl) || strings.HasPrefix(tmpl, "/") || strings.HasPrefix(tmpl, "\\") {
+		return fmt.Errorf("output template %q must be relative to the downloads folder", tmpl)
+	}
+	for _, part := range strings.FieldsFunc(tmpl, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return fmt.Errorf("output template %q must not escape the downloads folder", tmpl)
+		}
+	}
+	OutputTemplate = tmpl
+	return nil
 }
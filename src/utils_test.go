@@ -0,0 +1,445 @@
+package src
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsYouTubeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", true},
+		{"https://youtu.be/dQw4w9WgXcQ", true},
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ", true},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ", true},
+		{"youtube.com/watch?v=dQw4w9WgXcQ", true},
+		{"www.youtube.com/shorts/dQw4w9WgXcQ", true},
+		{"youtu.be/dQw4w9WgXcQ", true},
+		{"  https://www.youtube.com/watch?v=dQw4w9WgXcQ  ", true},
+		{"https://vimeo.com/123456", false},
+		{"https://notyoutube.com/watch?v=dQw4w9WgXcQ", false},
+		{"https://youtube.com.evil.example/watch?v=dQw4w9WgXcQ", false},
+		{"ytsearch1:never gonna give you up", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsYouTubeURL(tt.url); got != tt.want {
+			t.Errorf("IsYouTubeURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	const canonical = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{canonical, canonical},
+		{"https://youtube.com/watch?v=dQw4w9WgXcQ", canonical},
+		{"http://www.youtube.com/watch?v=dQw4w9WgXcQ", canonical},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ", canonical},
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ", canonical},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=10", canonical},
+		{"https://www.youtube.com/watch?t=10&v=dQw4w9WgXcQ&list=PL123&index=2", canonical},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&si=abc&feature=share", canonical},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ#t=30", canonical},
+		{"https://youtu.be/dQw4w9WgXcQ", canonical},
+		{"https://youtu.be/dQw4w9WgXcQ?t=42&si=abc", canonical},
+		{"https://www.youtube.com/shorts/dQw4w9WgXcQ", canonical},
+		{"https://www.youtube.com/embed/dQw4w9WgXcQ", canonical},
+		{"https://www.youtube.com/live/dQw4w9WgXcQ?feature=share", canonical},
+		{"https://www.youtube.com/v/dQw4w9WgXcQ", canonical},
+		{"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", canonical},
+		{"youtube.com/watch?v=dQw4w9WgXcQ", canonical},
+		{"www.youtube.com/watch?v=dQw4w9WgXcQ", canonical},
+		{"youtu.be/dQw4w9WgXcQ", canonical},
+		{"  https://youtu.be/dQw4w9WgXcQ  ", canonical},
+
+		// Playlist pages
+		{"https://www.youtube.com/playlist?list=PL123", "https://www.youtube.com/playlist?list=PL123"},
+		{"youtube.com/playlist?list=PL123", "https://www.youtube.com/playlist?list=PL123"},
+		{"https://music.youtube.com/playlist?list=PL123&si=abc", "https://www.youtube.com/playlist?list=PL123"},
+		{"https://www.youtube.com/playlist?list=PL123#top", "https://www.youtube.com/playlist?list=PL123"},
+
+		// Not a single video or playlist: left alone apart from the fragment
+		{"https://www.youtube.com/@channel/videos", "https://www.youtube.com/@channel/videos"},
+		{"https://www.youtube.com/shorts/tooshort", "https://www.youtube.com/shorts/tooshort"},
+		{"https://youtu.be/", "https://youtu.be/"},
+		{"https://youtu.be/about", "https://youtu.be/about"},
+		{"https://vimeo.com/123456", "https://vimeo.com/123456"},
+		{"https://vimeo.com/123456#t=30", "https://vimeo.com/123456"},
+		{"https://example.com/video?id=1&t=10", "https://example.com/video?id=1&t=10"},
+		{"ytsearch:lofi #beats", "ytsearch:lofi #beats"},
+		{"ytsearch5:lofi", "ytsearch5:lofi"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeURL(tt.url); got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+		if got := NormalizeURL(tt.want); got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want it unchanged", tt.want, got)
+		}
+	}
+}
+
+func TestYouTubeVideoID(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"youtu.be/dQw4w9WgXcQ?t=1", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/shorts/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/playlist?list=PL123", ""},
+		{"https://www.youtube.com/channel/UC123", ""},
+		{"https://vimeo.com/123456", ""},
+		{"ytsearch:lofi", ""},
+	}
+
+	for _, tt := range tests {
+		if got := YouTubeVideoID(tt.url); got != tt.want {
+			t.Errorf("YouTubeVideoID(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestSingleVideoURL(t *testing.T) {
+	const video = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	tests := []struct {
+		url                string
+		watchWithPlaylist  bool
+		mix                bool
+		single, noPlaylist string
+	}{
+		// Playlist context is kept unless asked not to
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123", true, false, "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123", video},
+		{"youtube.com/watch?v=dQw4w9WgXcQ&list=PL123&index=2", true, false, "youtube.com/watch?v=dQw4w9WgXcQ&list=PL123&index=2", video},
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ&list=OLAK5uy", true, false, "https://music.youtube.com/watch?v=dQw4w9WgXcQ&list=OLAK5uy", video},
+		{"https://youtu.be/dQw4w9WgXcQ?list=PL123", true, false, "https://youtu.be/dQw4w9WgXcQ?list=PL123", video},
+		{"youtu.be/dQw4w9WgXcQ?list=PL123", true, false, "youtu.be/dQw4w9WgXcQ?list=PL123", video},
+
+		// Mixes are endless, so they always become the video
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=RDdQw4w9WgXcQ&start_radio=1", true, true, video, video},
+		{"www.youtube.com/watch?v=dQw4w9WgXcQ&list=RDMM", true, true, video, video},
+
+		// Not a video opened from a playlist: unchanged
+		{"https://www.youtube.com/playlist?list=PL123", false, false, "https://www.youtube.com/playlist?list=PL123", "https://www.youtube.com/playlist?list=PL123"},
+		{"https://www.youtube.com/playlist?list=RDdQw4w9WgXcQ", false, true, "https://www.youtube.com/playlist?list=RDdQw4w9WgXcQ", "https://www.youtube.com/playlist?list=RDdQw4w9WgXcQ"},
+		{"https://www.youtube.com/watch?list=PL123", false, false, "https://www.youtube.com/watch?list=PL123", "https://www.youtube.com/watch?list=PL123"},
+		{"https://youtu.be/?list=PL123", false, false, "https://youtu.be/?list=PL123", "https://youtu.be/?list=PL123"},
+		{video, false, false, video, video},
+		{"https://example.com/watch?v=dQw4w9WgXcQ&list=PL123", false, false, "https://example.com/watch?v=dQw4w9WgXcQ&list=PL123", "https://example.com/watch?v=dQw4w9WgXcQ&list=PL123"},
+		{"https://www.youtube.com.evil.example/watch?v=dQw4w9WgXcQ&list=PL123", false, false, "https://www.youtube.com.evil.example/watch?v=dQw4w9WgXcQ&list=PL123", "https://www.youtube.com.evil.example/watch?v=dQw4w9WgXcQ&list=PL123"},
+	}
+
+	for _, tt := range tests {
+		if got := IsWatchWithPlaylist(tt.url); got != tt.watchWithPlaylist {
+			t.Errorf("IsWatchWithPlaylist(%q) = %v, want %v", tt.url, got, tt.watchWithPlaylist)
+		}
+		if got := IsMixURL(tt.url); got != tt.mix {
+			t.Errorf("IsMixURL(%q) = %v, want %v", tt.url, got, tt.mix)
+		}
+		if got := SingleVideoURL(tt.url, false); got != tt.single {
+			t.Errorf("SingleVideoURL(%q, false) = %q, want %q", tt.url, got, tt.single)
+		}
+		if got := SingleVideoURL(tt.url, true); got != tt.noPlaylist {
+			t.Errorf("SingleVideoURL(%q, true) = %q, want %q", tt.url, got, tt.noPlaylist)
+		}
+	}
+}
+
+func TestIsPlaylistURL(t *testing.T) {
+	tests := []struct {
+		url               string
+		playlist, channel bool
+	}{
+		{"https://www.youtube.com/playlist?list=PL123", true, false},
+		{"youtube.com/playlist?list=PL123", true, false},
+		{"https://music.youtube.com/playlist?list=OLAK5uy", true, false},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123", true, false},
+		{"https://youtu.be/dQw4w9WgXcQ?list=PL123", true, false},
+		{"https://www.youtube.com/@channel", true, true},
+		{"https://www.youtube.com/@channel/videos", true, true},
+		{"www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw", true, true},
+		{"https://www.youtube.com/c/SomeName", true, true},
+		{"https://www.youtube.com/user/someone/videos", true, true},
+
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", false, false},
+		{"https://youtu.be/dQw4w9WgXcQ", false, false},
+		{"https://www.youtube.com/playlist", false, false},
+		{"https://www.youtube.com/@", false, false},
+		{"https://www.youtube.com/channel/", false, false},
+		{"https://youtu.be/@channel", false, false},
+
+		// Other sites only by a /playlist(s) path segment
+		{"https://soundcloud.com/artist/sets/album", false, false},
+		{"https://example.com/playlist/123", true, false},
+		{"https://example.com/user/playlists", true, false},
+		{"https://example.com/watch?list=PL123", false, false},
+		{"https://example.com/@channel", false, false},
+		{"https://example.com/myplaylist", false, false},
+
+		// Lookalikes of YouTube and its paths
+		{"https://youtube.com.evil.example/playlist?list=PL123", true, false}, // Just another site with a /playlist path
+		{"https://youtube.com.evil.example/@channel", false, false},
+		{"https://evil.example/?u=youtube.com/playlist?list=PL123", false, false},
+		{"https://evil.example/youtube.com/@channel", false, false},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ#list=PL123", false, false},
+		{"ytsearch:playlist", false, false},
+		{"", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPlaylistURL(tt.url); got != tt.playlist {
+			t.Errorf("IsPlaylistURL(%q) = %v, want %v", tt.url, got, tt.playlist)
+		}
+		if got := IsChannelURL(tt.url); got != tt.channel {
+			t.Errorf("IsChannelURL(%q) = %v, want %v", tt.url, got, tt.channel)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+	}{
+		{"1048576", 1048576},
+		{"0", 0},
+		{"500K", 500 << 10},
+		{"500k", 500 << 10},
+		{"500KB", 500 << 10},
+		{"500KiB", 500 << 10},
+		{"200M", 200 << 20},
+		{"200MB", 200 << 20},
+		{"1.5G", 3 << 29},
+		{"2g", 2 << 30},
+		{" 10 M ", 10 << 20},
+		{"100B", 100},
+	}
+	for _, tt := range tests {
+		if got, err := ParseSize(tt.size); err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.size, got, err, tt.want)
+		}
+	}
+
+	for _, size := range []string{"", "M", "-5M", "5T", "5 MBs", "1e6", "five", "1,5G", "0x10"} {
+		if got, err := ParseSize(size); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", size, got)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	const day = 24 * time.Hour
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"90m", 90 * time.Minute},
+		{"12h", 12 * time.Hour},
+		{"30s", 30 * time.Second},
+		{"7d", 7 * day},
+		{"2w", 14 * day},
+		{"1d12h", day + 12*time.Hour},
+		{"1w2d", 9 * day},
+		{"1.5d", 36 * time.Hour},
+		{"0.5w", 84 * time.Hour},
+		{"2h30m", 150 * time.Minute},
+		{" 3d ", 3 * day},
+		{"0d", 0},
+	}
+	for _, tt := range tests {
+		if got, err := ParseDuration(tt.s); err != nil || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "7", "d", "7days", "1y", "two weeks", "-", "1d 12h", "w2"} {
+		if got, err := ParseDuration(s); err == nil {
+			t.Errorf("ParseDuration(%q) = %v, want an error", s, got)
+		}
+	}
+}
+
+func TestValidateSponsorBlockCategories(t *testing.T) {
+	tests := []struct {
+		cats       string
+		mark, drop bool // Valid for -sponsorblock-mark, for -sponsorblock-remove
+	}{
+		{"sponsor", true, true},
+		{"sponsor,intro,outro", true, true},
+		{" sponsor , selfpromo ", true, true},
+		{"all,-preview", true, true},
+		{"default,-filler", true, true},
+		{"music_offtopic,interaction", true, true},
+		{"poi_highlight", true, false},
+		{"sponsor,chapter", true, false},
+		{"all,-chapter", true, false}, // Excluding counts too, it can never be removed
+		{"", false, false},
+		{"  ", false, false},
+		{"sponsors", false, false},
+		{"Sponsor", false, false},
+		{"sponsor,", false, false},
+		{"sponsor;intro", false, false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateSponsorBlockCategories(tt.cats, false); (err == nil) != tt.mark {
+			t.Errorf("ValidateSponsorBlockCategories(%q, false) = %v, want valid %v", tt.cats, err, tt.mark)
+		}
+		if err := ValidateSponsorBlockCategories(tt.cats, true); (err == nil) != tt.drop {
+			t.Errorf("ValidateSponsorBlockCategories(%q, true) = %v, want valid %v", tt.cats, err, tt.drop)
+		}
+	}
+}
+
+func TestValidatePlaylistItems(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"1", true},
+		{"1-10", true},
+		{"1,3,5", true},
+		{"1-10,15,50:", true},
+		{" 1-3 , 7 ", true},
+		{"-1", true},
+		{"-5:", true},
+		{":10", true},
+		{"1:10:2", true},
+		{"::2", true},
+		{"::-1", true},
+		{"", false},
+		{" ", false},
+		{"1,,3", false},
+		{"1,", false},
+		{"a-b", false},
+		{"1-", false},
+		{"1--3", false},
+		{"1-3-5", false},
+		{"1:2:3:4", false},
+		{"1..3", false},
+		{"1;rm -rf", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidatePlaylistItems(tt.spec); (err == nil) != tt.valid {
+			t.Errorf("ValidatePlaylistItems(%q) = %v, want valid %v", tt.spec, err, tt.valid)
+		}
+	}
+}
+
+func TestSetOutputTemplate(t *testing.T) {
+	old := OutputTemplate
+	t.Cleanup(func() { OutputTemplate = old })
+
+	tests := []struct {
+		tmpl  string
+		valid bool
+	}{
+		{DefaultOutputTemplate, true},
+		{"%(uploader)s/%(title)s [%(id)s].%(ext)s", true},
+		{"%(upload_date>%Y)s/%(upload_date>%m)s/%(title)s.%(ext)s", true},
+		{"..%(title)s.%(ext)s", true},
+		{"a..b/%(title)s.%(ext)s", true},
+		{"./%(title)s.%(ext)s", true},
+		{"", false},
+		{"   ", false},
+		{"/tmp/%(title)s.%(ext)s", false},
+		{"\\server\\%(title)s.%(ext)s", false},
+		{"../%(title)s.%(ext)s", false},
+		{"%(uploader)s/../../%(title)s.%(ext)s", false},
+		{"%(uploader)s\\..\\%(title)s.%(ext)s", false},
+		{"..", false},
+	}
+
+	for _, tt := range tests {
+		OutputTemplate = DefaultOutputTemplate
+		err := SetOutputTemplate(tt.tmpl)
+		if (err == nil) != tt.valid {
+			t.Errorf("SetOutputTemplate(%q) = %v, want valid %v", tt.tmpl, err, tt.valid)
+		}
+		// A rejected template leaves the current one in place
+		want := DefaultOutputTemplate
+		if tt.valid {
+			want = tt.tmpl
+		}
+		if OutputTemplate != want {
+			t.Errorf("after SetOutputTemplate(%q), OutputTemplate = %q, want %q", tt.tmpl, OutputTemplate, want)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr string // Part of the error, "" if the URL is valid
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", ""},
+		{"http://example.com/video.mp4", ""},
+		{"youtu.be/dQw4w9WgXcQ", ""},
+		{"  https://vimeo.com/123456  ", ""},
+		{"http://localhost:8080/video", ""},
+		{"ytsearch:never gonna give you up", ""},
+		{"ytsearch5:lofi", ""},
+		{"ytsearchall:lofi", ""},
+		{"ytsearch:", "search query is empty"},
+		{"ytsearch3:   ", "search query is empty"},
+		{"dQw4w9WgXcQ", "looks like a video ID, use https://youtu.be/dQw4w9WgXcQ"},
+		{"", "doesn't look like a valid URL"},
+		{"hello", "doesn't look like a valid URL"},
+		{"ftp://example.com/video.mp4", "doesn't look like a valid URL"},
+		{"file:///etc/passwd", "doesn't look like a valid URL"},
+		{"javascript:alert(1)", "doesn't look like a valid URL"},
+		{"https://", "doesn't look like a valid URL"},
+		{"https://exa mple.com", "doesn't look like a valid URL"},
+		{"--exec=rm", "doesn't look like a valid URL"},
+	}
+
+	for _, tt := range tests {
+		err := ValidateURL(tt.url)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("ValidateURL(%q) = %v, want nil", tt.url, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("ValidateURL(%q) = %v, want an error containing %q", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateFormatSort(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"res", true},
+		{"res:1080", true},
+		{"res:1080,vcodec:av01,+size", true},
+		{" res:720 , fps ", true},
+		{"+res", true},
+		{"filesize~500M", true},
+		{"lang,quality,ext:mp4:m4a", true},
+		{"", false},
+		{" ", false},
+		{"resolution", false},
+		{"res:", false},
+		{"filesize~", false},
+		{"res,,fps", false},
+		{"-res", false},
+		{"Res", false},
+		{":1080", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateFormatSort(tt.spec); (err == nil) != tt.valid {
+			t.Errorf("ValidateFormatSort(%q) = %v, want valid %v", tt.spec, err, tt.valid)
+		}
+	}
+}
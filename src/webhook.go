@@ -0,0 +1,83 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookURL receives a POST for every completed or failed download when set
+var WebhookURL string
+
+const (
+	webhookTimeout = 10 * time.Second
+	webhookRetries = 3
+)
+
+type webhookPayload struct {
+	ID        string         `json:"id"`
+	URL       string         `json:"url"`
+	Title     string         `json:"title"`
+	Status    DownloadStatus `json:"status"`
+	FilePath  string         `json:"filePath"`
+	Error     string         `json:"error"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// PostWebhook sends a download record to endpoint as JSON, retrying a few times on failure
+func PostWebhook(endpoint string, rec DownloadRecord) error {
+	body, err := json.Marshal(webhookPayload{
+		ID:        rec.ID,
+		URL:       rec.URL,
+		Title:     rec.Title,
+		Status:    rec.Status,
+		FilePath:  rec.FilePath,
+		Error:     rec.Error,
+		Timestamp: rec.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	for attempt := 1; ; attempt++ {
+		err = postJSON(client, endpoint, body)
+		if err == nil || attempt == webhookRetries {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func postJSON(client *http.Client, endpoint string, body []byte) error {
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sendDownloadWebhook posts the current state of a download if a webhook is configured.
+// Failures are logged and never affect the download result
+func sendDownloadWebhook(db *DB, downloadID string) {
+	if WebhookURL == "" {
+		return
+	}
+
+	rec, err := db.GetDownload(downloadID)
+	if err != nil {
+		logger.Warn("failed to load download for webhook", "id", downloadID, "error", err)
+		return
+	}
+
+	if err := PostWebhook(WebhookURL, *rec); err != nil {
+		logger.Warn("webhook failed", "id", downloadID, "endpoint", WebhookURL, "error", err)
+	}
+}
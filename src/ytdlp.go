@@ -3,12 +3,18 @@ package src
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 func IsInstalled() bool {
@@ -16,6 +22,94 @@ func IsInstalled() bool {
 	return err == nil
 }
 
+// IsFfmpegInstalled checks for ffmpeg, which yt-dlp needs for merging formats and audio extraction
+func IsFfmpegInstalled() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil
+}
+
+// Timeouts for yt-dlp calls that only read metadata, so a network stall can't hang forever.
+// Playlists get longer since large ones take a while to page through
+var (
+	MetadataTimeout = 60 * time.Second
+	PlaylistTimeout = 10 * time.Minute
+)
+
+// MatchFilter is a yt-dlp --match-filter expression applied to playlist extraction and downloads.
+// Empty means no filter
+var MatchFilter string
+
+// matchFilterArgs returns the --match-filter arguments for MatchFilter. The expression is one
+// argument and never goes through a shell, so its quotes reach yt-dlp unchanged
+func matchFilterArgs() []string {
+	if MatchFilter == "" {
+		return nil
+	}
+	return []string{"--match-filter", MatchFilter}
+}
+
+// ErrTimeout is returned when a yt-dlp call exceeds its timeout
+var ErrTimeout = errors.New("yt-dlp timed out")
+
+// ytdlpOutput runs yt-dlp with a timeout and returns its stdout
+func ytdlpOutput(timeout time.Duration, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, _, err := YtdlpRunner.Run(ctx, args)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return output, fmt.Errorf("%w after %s", ErrTimeout, timeout)
+	}
+	return output, err
+}
+
+// ytdlpStaleAfter is how old a yt-dlp release can get before an update is suggested.
+// YouTube changes often enough that older releases tend to break
+const ytdlpStaleAfter = 90 * 24 * time.Hour
+
+// GetYtdlpVersion returns the installed yt-dlp version, e.g. "2025.09.26"
+func GetYtdlpVersion() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	output, _, err := YtdlpRunner.Run(ctx, []string{"--version"})
+	if err != nil {
+		return "", err
+	}
+
+	version := strings.TrimSpace(string(output))
+	if _, err := parseYtdlpVersionDate(version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// parseYtdlpVersionDate extracts the release date from a date-based version.
+// Nightly builds carry an extra suffix (2025.09.26.232618) which is ignored
+func parseYtdlpVersionDate(version string) (time.Time, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) < 3 {
+		return time.Time{}, fmt.Errorf("unexpected yt-dlp version %q", version)
+	}
+	date, err := time.Parse("2006.01.02", strings.Join(parts[:3], "."))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected yt-dlp version %q", version)
+	}
+	return date, nil
+}
+
+// YtdlpUpdateHint returns a hint if the given version is old enough that an update is advisable.
+// Returns empty string when the version is recent or can't be parsed
+func YtdlpUpdateHint(version string) string {
+	date, err := parseYtdlpVersionDate(version)
+	if err != nil {
+		return ""
+	}
+	if time.Since(date) > ytdlpStaleAfter {
+		return "yt-dlp is more than 90 days old, consider updating with 'yt-dlp -U'"
+	}
+	return ""
+}
 
 func NormalizeFilename(filename string) string {
 	// Replace spaces with underscores
@@ -35,86 +129,366 @@ func NormalizeFilename(filename string) string {
 	return filename
 }
 
+// NormalizeFilenameWithFallback normalizes a filename, falling back to the normalized
+// fallback (typically the video ID) when nothing survives, e.g. for all-Unicode or
+// all-symbol titles. Returns "untitled" if both normalize to empty
+func NormalizeFilenameWithFallback(filename, fallback string) string {
+	if normalized := NormalizeFilename(filename); normalized != "" {
+		return normalized
+	}
+	if normalized := NormalizeFilename(fallback); normalized != "" {
+		return normalized
+	}
+	return "untitled"
+}
+
 // DownloadOptions contains options for downloading videos
 type DownloadOptions struct {
 	URL        string
 	OutputPath string
+	Format     string // Passed as -f when set
 	ExtraArgs  []string
 	Context    context.Context
+	Stderr     io.Writer // Optional, receives a copy of yt-dlp's stderr
+	// RestrictFilenames passes --restrict-filenames, limiting names to ASCII without spaces.
+	// Downloads started by the wrapper set it from the package-level RestrictFilenames
+	RestrictFilenames bool
+	// Silent keeps verbose mode from printing the command, for downloads running behind the TUI
+	Silent bool
 }
 
-func Download(opts DownloadOptions) error {
+// RestrictFilenames is the default for DownloadOptions.RestrictFilenames. Turn it off to
+// keep titles as they are, including non-ASCII characters
+var RestrictFilenames = true
+
+// DryRun makes Download and DownloadWithCallback print the yt-dlp command instead of running it
+var DryRun bool
+
+// buildYtdlpArgs assembles the yt-dlp arguments for a download. Download and
+// DownloadWithCallback both use it so their arguments can't drift apart
+func buildYtdlpArgs(opts DownloadOptions) []string {
 	args := []string{}
 
-	args = append(args, "--restrict-filenames")
+	if opts.RestrictFilenames {
+		args = append(args, "--restrict-filenames")
+	}
 
 	if opts.OutputPath != "" {
 		args = append(args, "-o", opts.OutputPath)
 	}
 
+	if opts.Format != "" {
+		args = append(args, "-f", opts.Format)
+	}
+
+	if !HasArg(opts.ExtraArgs, "--match-filter") {
+		args = append(args, matchFilterArgs()...)
+	}
+
 	args = append(args, opts.ExtraArgs...)
 	args = append(args, opts.URL)
+	return args
+}
 
-	var cmd *exec.Cmd
-	if opts.Context != nil {
-		cmd = exec.CommandContext(opts.Context, "yt-dlp", args...)
-	} else {
-		cmd = exec.Command("yt-dlp", args...)
+// announceCommand logs the yt-dlp command about to run and prints it in verbose mode unless silent.
+// In a dry run it only prints the command and returns true, the command must not be run
+func announceCommand(args []string, silent bool) bool {
+	if DryRun {
+		fmt.Println(shellCommand(redactArgs(args)))
+		return true
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	command := "yt-dlp " + strings.Join(redactArgs(args), " ")
+	logger.Info("running yt-dlp", "command", command)
+	if Verbose && !silent {
+		fmt.Println(command)
+	}
+	return false
+}
 
-	return cmd.Run()
+// shellCommand renders a yt-dlp command line that can be pasted into a POSIX shell
+func shellCommand(args []string) string {
+	quoted := []string{"yt-dlp"}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
 }
 
-// DownloadWithCallback executes yt-dlp and calls the callback for each output line
-func DownloadWithCallback(opts DownloadOptions, callback func(string)) error {
-	args := []string{}
+// shellQuote single-quotes arg unless it only has characters a shell leaves alone
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,+@%", r))
+	}) < 0 {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
 
-	args = append(args, "--restrict-filenames")
+func Download(opts DownloadOptions) error {
+	args := buildYtdlpArgs(opts)
+	if announceCommand(args, opts.Silent) {
+		return nil
+	}
 
-	if opts.OutputPath != "" {
-		args = append(args, "-o", opts.OutputPath)
+	var stderr io.Writer = os.Stderr
+	if opts.Stderr != nil {
+		stderr = io.MultiWriter(os.Stderr, opts.Stderr)
 	}
 
-	args = append(args, opts.ExtraArgs...)
-	args = append(args, opts.URL)
+	return YtdlpRunner.Stream(downloadContext(opts), args, os.Stdout, stderr)
+}
 
-	var cmd *exec.Cmd
+// downloadContext returns the context a download runs under
+func downloadContext(opts DownloadOptions) context.Context {
 	if opts.Context != nil {
-		cmd = exec.CommandContext(opts.Context, "yt-dlp", args...)
-	} else {
-		cmd = exec.Command("yt-dlp", args...)
+		return opts.Context
 	}
+	return context.Background()
+}
 
-	// Create pipes for stdout and stderr
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
+// ProgressReporter receives the events of a running download, one at a time
+type ProgressReporter interface {
+	// OnProgress is called for each progress line. pct is 0-100; eta and speed are as
+	// printed by yt-dlp and empty when unknown
+	OnProgress(pct float64, eta, speed string)
+	// OnFragment is called instead of OnProgress for fragmented downloads of unknown
+	// length, such as live HLS streams, with the number of the fragment being downloaded
+	OnFragment(fragment int, speed string)
+	// OnDestination is called for every file yt-dlp starts writing, including merged and extracted outputs
+	OnDestination(path string)
+	// OnLine is called for every other output line
+	OnLine(raw string)
+}
+
+var (
+	// Progress lines start with the percentage, or with the size so far when it's unknown
+	progressRegex    = regexp.MustCompile(`^\[download\]\s+(?:(\d+(?:\.\d+)?)%\s+of\b|(?:Unknown|N/A)%\s+of\b|~?\s*[\d.]+\s*\w*B\s+at\b)`)
+	etaRegex         = regexp.MustCompile(`ETA\s+(\d{2}:\d{2}(?::\d{2})?)`)
+	speedRegex       = regexp.MustCompile(`at\s+(\S+/s)`)
+	totalSizeRegex   = regexp.MustCompile(`of\s+(~?)\s*([\d.]+\s*\w*B)\b`)
+	fragmentRegex    = regexp.MustCompile(`\(frag (\d+)/([^)]*)\)`)
+	destinationRegex = regexp.MustCompile(`\[download\] Destination: (.+)`)
+	chapterFileRegex = regexp.MustCompile(`\[SplitChapters\] Chapter \d+; Destination: (.+)`)
+	// yt-dlp exits successfully when a filter rejects the video, this is its only trace
+	skippedRegex = regexp.MustCompile(`^\[download\] (.*(?:than (?:max|min)-filesize|does not pass filter|already been recorded in the archive).*)$`)
+	// Files left by an earlier run aren't reported with a Destination line
+	existingFileRegex = regexp.MustCompile(`^\[download\] (.+) has already been downloaded$`)
+	// Post-processors that write a new final file
+	finalFileRegex = regexp.MustCompile(`\[(?:Merger\] Merging formats into|ExtractAudio\] Destination:) "?([^"]+)"?$`)
+)
+
+// ProgressEvent is the information in one yt-dlp progress line
+type ProgressEvent struct {
+	Percent       float64 // 0-100, or -1 when yt-dlp doesn't know it
+	ETA           string  // Empty if unknown
+	Speed         string  // e.g. "2.50MiB/s", empty if unknown
+	TotalSize     string  // e.g. "10.00MiB", prefixed with "~" when estimated, empty if unknown
+	Fragment      int     // Current fragment of DASH/HLS downloads, 0 if not fragmented
+	FragmentTotal int     // Fragment count, 0 if unknown (e.g. live streams)
+}
+
+// ParseProgressLine parses a yt-dlp "[download]" progress line. Returns false for any other line
+func ParseProgressLine(line string) (ProgressEvent, bool) {
+	matches := progressRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return ProgressEvent{}, false
 	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return err
+
+	event := ProgressEvent{Percent: -1}
+	if matches[1] != "" {
+		if pct, err := strconv.ParseFloat(matches[1], 64); err == nil {
+			event.Percent = pct
+		}
+	}
+	if m := etaRegex.FindStringSubmatch(line); m != nil {
+		event.ETA = m[1]
+	}
+	if m := speedRegex.FindStringSubmatch(line); m != nil {
+		event.Speed = m[1]
 	}
+	if m := totalSizeRegex.FindStringSubmatch(line); m != nil {
+		event.TotalSize = m[1] + strings.ReplaceAll(m[2], " ", "")
+	}
+	if m := fragmentRegex.FindStringSubmatch(line); m != nil {
+		event.Fragment, _ = strconv.Atoi(m[1])
+		event.FragmentTotal, _ = strconv.Atoi(m[2])
+		if event.FragmentTotal < 0 {
+			event.FragmentTotal = 0
+		}
+	}
+	return event, true
+}
+
+// DownloadWithReporter executes yt-dlp, parsing its output once and passing the
+// resulting events to reporter. Add --newline to ExtraArgs to get every progress update
+func DownloadWithReporter(opts DownloadOptions, reporter ProgressReporter) error {
+	d := &progressDispatcher{reporter: reporter}
+	return DownloadWithCallback(opts, d.dispatch)
+}
+
+// progressDispatcher turns lines of yt-dlp output into ProgressReporter events
+type progressDispatcher struct {
+	reporter ProgressReporter
+	lastPct  float64 // Of the current file, so fragment progress never goes backwards
+}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return err
+// dispatch passes the event described by a line of yt-dlp output to the reporter
+func (d *progressDispatcher) dispatch(line string) {
+	if matches := destinationRegex.FindStringSubmatch(line); len(matches) > 1 {
+		d.lastPct = 0
+		d.reporter.OnDestination(matches[1])
+		return
+	}
+	if matches := finalFileRegex.FindStringSubmatch(line); len(matches) > 1 {
+		d.reporter.OnDestination(matches[1])
+		return
+	}
+	if matches := existingFileRegex.FindStringSubmatch(line); len(matches) > 1 {
+		d.reporter.OnDestination(matches[1])
+		return
 	}
 
+	event, ok := ParseProgressLine(line)
+	if !ok {
+		d.reporter.OnLine(line)
+		return
+	}
+
+	pct := event.Percent
+	switch {
+	case event.FragmentTotal > 0:
+		// yt-dlp's percentage for DASH/HLS is estimated from fragment sizes and jumps
+		// around, the share of fragments done is steadier
+		pct = float64(event.Fragment) / float64(event.FragmentTotal) * 100
+		if event.Percent >= 100 {
+			pct = 100
+		}
+	case event.Fragment > 0 && event.Percent < 0:
+		// Live streams have no total to measure against
+		d.reporter.OnFragment(event.Fragment, event.Speed)
+		return
+	}
+	if pct < 0 {
+		d.reporter.OnLine(line)
+		return
+	}
+
+	pct = max(min(pct, 100), d.lastPct)
+	d.lastPct = pct
+	d.reporter.OnProgress(pct, event.ETA, event.Speed)
+}
+
+// stderrTailLines is how many of yt-dlp's last stderr lines a failed download reports
+const stderrTailLines = 20
+
+// ExitError is returned when yt-dlp exits with an error. "exit status 1" alone says
+// little, so it carries the last lines yt-dlp wrote to stderr
+type ExitError struct {
+	Err    error
+	Stderr []string
+}
+
+func (e *ExitError) Error() string {
+	if len(e.Stderr) == 0 {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + "\n" + strings.Join(e.Stderr, "\n")
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Summary returns yt-dlp's last ERROR line, or the exit status if it printed none
+func (e *ExitError) Summary() string {
+	for i := len(e.Stderr) - 1; i >= 0; i-- {
+		if strings.HasPrefix(e.Stderr[i], "ERROR:") {
+			return e.Stderr[i]
+		}
+	}
+	return e.Err.Error()
+}
+
+// DownloadWithCallback executes yt-dlp and calls the callback for each raw output line.
+// If yt-dlp fails the error is an *ExitError with the end of its stderr
+func DownloadWithCallback(opts DownloadOptions, callback func(string)) error {
+	args := buildYtdlpArgs(opts)
+	if announceCommand(args, opts.Silent) {
+		return nil
+	}
+
+	// Run yt-dlp in the background, the pipes close once it's done
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := YtdlpRunner.Stream(downloadContext(opts), args, stdoutWriter, stderrWriter)
+		stdoutWriter.Close()
+		stderrWriter.Close()
+		done <- err
+	}()
+
 	// Read from both stdout and stderr
-	go readAndCallback(stdout, callback)
-	go readAndCallback(stderr, callback)
+	var stderrReader io.Reader = stderr
+	if opts.Stderr != nil {
+		stderrReader = io.TeeReader(stderr, opts.Stderr)
+	}
+
+	// Serialize the callback so callers never see lines from both streams concurrently
+	var mu sync.Mutex
+	lockedCallback := func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		callback(line)
+	}
+
+	// Only the stderr reader appends, and it's done once wg.Wait returns
+	var stderrTail []string
+	stderrCallback := func(line string) {
+		if strings.TrimSpace(line) != "" {
+			stderrTail = append(stderrTail, line)
+			if len(stderrTail) > stderrTailLines {
+				stderrTail = stderrTail[1:]
+			}
+		}
+		lockedCallback(line)
+	}
+
+	// Both pipes must be fully read or yt-dlp blocks writing to them
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		readAndCallback(stdout, lockedCallback)
+	}()
+	go func() {
+		defer wg.Done()
+		readAndCallback(stderrReader, stderrCallback)
+	}()
+	wg.Wait()
 
-	return cmd.Wait()
+	if err := <-done; err != nil {
+		return &ExitError{Err: err, Stderr: stderrTail}
+	}
+	return nil
 }
 
+// maxLineSize bounds a single output line; yt-dlp JSON output and tracebacks can exceed 64KB
+const maxLineSize = 16 * 1024 * 1024
+
 func readAndCallback(r io.Reader, callback func(string)) {
 	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
 	for scanner.Scan() {
 		callback(scanner.Text())
 	}
+	if err := scanner.Err(); err != nil {
+		logger.Error("failed to read yt-dlp output", "error", err)
+		callback(fmt.Sprintf("ERROR: failed to read yt-dlp output: %v", err))
+		// Drain the rest so yt-dlp doesn't block on a full pipe
+		io.Copy(io.Discard, r)
+	}
 }
 
 type PlaylistInfo struct {
@@ -130,93 +504,155 @@ type VideoInfo struct {
 	ID         string
 	Channel    string
 	ChannelURL string
+	Index      int       // Position in the original playlist, 0 if unknown
+	Duration   int       // Seconds, 0 if unknown
+	UploadDate string    // YYYYMMDD, empty if unknown
+	ViewCount  *int64    // nil if unknown
+	LikeCount  *int64    // nil if unknown
+	LiveStatus string    // yt-dlp's live_status for streams and premieres, empty for regular videos
+	StartsAt   time.Time // When an upcoming stream or premiere starts, zero if unknown
 }
 
-func ExtractPlaylist(playlistURL string) (*PlaylistInfo, error) {
-	// If it's a channel URL, try to get the canonical channel ID/URL first
-	var canonicalChannelURL string
-	if IsChannelURL(playlistURL) {
-		canonicalChannelURL = extractChannelURL(playlistURL)
-	}
+// Live statuses yt-dlp reports for streams and premieres
+const (
+	liveStatusLive     = "is_live"
+	liveStatusUpcoming = "is_upcoming"
+	liveStatusWasLive  = "was_live"
+	liveStatusPostLive = "post_live" // Ended, but not processed into a regular video yet
+)
 
-	args := []string{
-		"--flat-playlist",
-		"--get-url",
-		"--print", "%(playlist_title,playlist)s|%(playlist_channel,channel)s|%(playlist_channel_url,channel_url)s|%(playlist_index)s|%(id)s|%(title)s|%(channel)s|%(channel_url)s|%(url)s",
-		playlistURL,
-	}
+// Separators for --print templates. Titles can contain "|", tabs and even newlines,
+// but never these ASCII control characters
+const (
+	printFieldSep  = "\x1f" // Unit separator, between fields
+	printRecordSep = "\x1e" // Record separator, after each entry
+)
 
-	cmd := exec.Command("yt-dlp", args...)
+// printTemplate builds a --print template printing the given fields as one record
+func printTemplate(fields ...string) string {
+	return strings.Join(fields, printFieldSep) + printRecordSep
+}
 
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, err
+// parsePrintRecords splits --print output built with printTemplate into records,
+// skipping any that don't have exactly n fields
+func parsePrintRecords(output []byte, n int) [][]string {
+	var records [][]string
+	for _, record := range strings.Split(string(output), printRecordSep) {
+		record = strings.Trim(record, "\r\n")
+		if record == "" {
+			continue
+		}
+		fields := strings.Split(record, printFieldSep)
+		if len(fields) != n {
+			continue
+		}
+		records = append(records, fields)
 	}
+	return records
+}
 
-	lines := strings.Split(string(output), "\n")
-	info := &PlaylistInfo{
-		Videos: make([]VideoInfo, 0),
+// IsPlaylist decides whether a URL should be saved as a playlist instead of downloaded.
+//
+// YouTube URLs, and URLs with a /playlist path on any site, are classified by IsPlaylistURL.
+// Other sites' playlist URLs have no common shape, so yt-dlp is asked whether the URL
+// resolves to a playlist by printing the playlist ID and count of its first entry. That costs
+// an extra yt-dlp call, and falls back to IsPlaylistURL if yt-dlp fails.
+//
+// Limits: sites that present a single post as a playlist, such as multi-part videos or posts
+// with several clips, are detected as playlists. Use -single or -playlist to override
+func IsPlaylist(urlStr string) bool {
+	if IsPlaylistURL(urlStr) {
+		return true
 	}
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	// Searches download their top result
+	if _, ok := SearchQuery(urlStr); ok {
+		return false
+	}
+	if parsed, err := parseURL(urlStr); err == nil {
+		switch youtubeHost(parsed) {
+		case "youtube.com", "music.youtube.com", "youtu.be":
+			return false
 		}
+	}
+
+	output, err := ytdlpOutput(MetadataTimeout,
+		"--flat-playlist",
+		"--playlist-items", "1",
+		"--print", printTemplate("%(playlist_id)s", "%(playlist_count)s"),
+		urlStr,
+	)
+	if err != nil {
+		logger.Warn("failed to detect playlist", "url", urlStr, "error", err)
+		return false
+	}
 
-		// Parse format: playlist_title|playlist_channel|playlist_channel_url|index|id|title|channel|channel_url|url
-		parts := strings.SplitN(line, "|", 9)
-		if len(parts) == 9 {
-			// Extract playlist info from first video
-			if info.Title == "" {
-				info.Title = parts[0]
-				info.Channel = parts[1]
-				// Clean the playlist channel URL immediately
-				info.ChannelURL = CleanChannelURL(parts[2])
+	for _, fields := range parsePrintRecords(output, 2) {
+		for _, field := range fields {
+			if field != "" && field != "NA" {
+				return true
 			}
+		}
+	}
+	return false
+}
 
-			videoChannel := parts[6]
-			videoChannelURL := parts[7]
+func ExtractPlaylist(playlistURL string) (*PlaylistInfo, error) {
+	return ExtractPlaylistItems(playlistURL, "")
+}
 
-			// Fallback: Use playlist channel info if video channel is missing or NA
-			if videoChannel == "" || videoChannel == "NA" {
-				videoChannel = parts[1] // Use playlist_channel
-			}
-			if videoChannelURL == "" || videoChannelURL == "NA" {
-				// If we have a canonical channel URL, use it; otherwise use playlist_channel_url
-				if canonicalChannelURL != "" {
-					videoChannelURL = canonicalChannelURL
-				} else {
-					videoChannelURL = parts[2] // Use playlist_channel_url
-				}
-			}
+// ResolveSearch finds the top YouTube search result for query
+func ResolveSearch(query string) (*VideoInfo, error) {
+	output, err := ytdlpOutput(MetadataTimeout,
+		"--flat-playlist",
+		"--print", printTemplate("%(id)s", "%(title)s", "%(url)s"),
+		"ytsearch1:"+query,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-			// Clean the video channel URL
-			videoChannelURL = CleanChannelURL(videoChannelURL)
+	records := parsePrintRecords(output, 3)
+	if len(records) == 0 || records[0][0] == "" {
+		return nil, fmt.Errorf("no results found for %q", query)
+	}
+	// Fields: id, title, url
+	video := &VideoInfo{ID: records[0][0], Title: records[0][1], URL: records[0][2]}
+	if video.URL == "" || video.URL == "NA" {
+		video.URL = "https://www.youtube.com/watch?v=" + video.ID
+	}
+	video.URL = NormalizeURL(video.URL)
+	return video, nil
+}
 
-			// Ensure video channel name is never empty
-			if videoChannel == "" || videoChannel == "NA" {
-				if videoChannelURL != "" && videoChannelURL != "NA" {
-					videoChannel = extractChannelNameFromURL(videoChannelURL)
-				} else {
-					videoChannel = "Unknown Channel"
-				}
-			}
+// ExtractPlaylistItems extracts only the playlist entries selected by items, a
+// --playlist-items spec such as "1-10" or "1,3,5". An empty spec selects everything
+func ExtractPlaylistItems(playlistURL, items string) (*PlaylistInfo, error) {
+	// If it's a channel URL, try to get the canonical channel ID/URL first
+	var canonicalChannelURL string
+	if IsChannelURL(playlistURL) {
+		canonicalChannelURL = extractChannelURL(playlistURL)
+	}
 
-			// Ensure video channel URL is never empty
-			if videoChannelURL == "" || videoChannelURL == "NA" {
-				// This shouldn't happen after fallbacks, but just in case
-				videoChannelURL = ""
-			}
+	// Flat entries lack some fields, yt-dlp lets them through filters on those fields
+	args := []string{"--flat-playlist", "-J"}
+	if items != "" {
+		args = append(args, "--playlist-items", items)
+	}
+	args = append(args, matchFilterArgs()...)
+	args = append(args, playlistURL)
 
-			video := VideoInfo{
-				ID:         parts[4],
-				Title:      parts[5],
-				Channel:    videoChannel,
-				ChannelURL: videoChannelURL,
-				URL:        parts[8],
-			}
-			info.Videos = append(info.Videos, video)
+	output, err := ytdlpOutput(PlaylistTimeout, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := parsePlaylistJSON(output, canonicalChannelURL)
+	if err != nil {
+		// Fall back to the --print template if yt-dlp's JSON couldn't be read
+		logger.Warn("failed to parse playlist JSON, retrying with --print", "url", playlistURL, "error", err)
+		info, err = extractPlaylistPrint(playlistURL, items, canonicalChannelURL)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -258,6 +694,206 @@ func ExtractPlaylist(playlistURL string) (*PlaylistInfo, error) {
 	return info, nil
 }
 
+// playlistJSON is the part of yt-dlp's --flat-playlist -J output we use.
+// Fields yt-dlp doesn't know come back as null and are left empty
+type playlistJSON struct {
+	Title       string      `json:"title"`
+	Channel     string      `json:"channel"`
+	ChannelURL  string      `json:"channel_url"`
+	Uploader    string      `json:"uploader"`
+	UploaderURL string      `json:"uploader_url"`
+	Entries     []videoJSON `json:"entries"`
+}
+
+// videoJSON is the part of yt-dlp's -J output for a single video we use
+type videoJSON struct {
+	ID            string  `json:"id"`
+	Title         string  `json:"title"`
+	URL           string  `json:"url"`
+	WebpageURL    string  `json:"webpage_url"`
+	Channel       string  `json:"channel"`
+	ChannelURL    string  `json:"channel_url"`
+	Uploader      string  `json:"uploader"`
+	UploaderURL   string  `json:"uploader_url"`
+	PlaylistIndex int     `json:"playlist_index"`
+	Duration      float64 `json:"duration"`
+	UploadDate    string  `json:"upload_date"` // YYYYMMDD
+	ViewCount     *int64  `json:"view_count"`
+	LikeCount     *int64  `json:"like_count"`
+	LiveStatus    string  `json:"live_status"`
+	IsLive        bool    `json:"is_live"` // Older extractors set only this
+	ReleaseTime   *int64  `json:"release_timestamp"`
+}
+
+// liveStatus returns the video's live status, or "" for a regular video
+func (v videoJSON) liveStatus() string {
+	switch v.LiveStatus {
+	case "", "not_live", "NA":
+		if v.IsLive {
+			return liveStatusLive
+		}
+		return ""
+	}
+	return v.LiveStatus
+}
+
+// channel returns the channel name and URL, falling back to the uploader
+func (v videoJSON) channel() (string, string) {
+	name, url := v.Channel, v.ChannelURL
+	if name == "" {
+		name = v.Uploader
+	}
+	if url == "" {
+		url = v.UploaderURL
+	}
+	return name, url
+}
+
+// parsePlaylistJSON builds a PlaylistInfo from yt-dlp's --flat-playlist -J output
+func parsePlaylistJSON(output []byte, canonicalChannelURL string) (*PlaylistInfo, error) {
+	var playlist playlistJSON
+	if err := json.Unmarshal(output, &playlist); err != nil {
+		return nil, fmt.Errorf("failed to parse playlist: %w", err)
+	}
+
+	playlistChannel, playlistChannelURL := playlist.Channel, playlist.ChannelURL
+	if playlistChannel == "" {
+		playlistChannel = playlist.Uploader
+	}
+	if playlistChannelURL == "" {
+		playlistChannelURL = playlist.UploaderURL
+	}
+
+	info := &PlaylistInfo{
+		Title:      playlist.Title,
+		Channel:    playlistChannel,
+		ChannelURL: CleanChannelURL(playlistChannelURL),
+		Videos:     make([]VideoInfo, 0, len(playlist.Entries)),
+	}
+
+	for _, entry := range playlist.Entries {
+		channel, channelURL := entry.channel()
+		channel, channelURL = playlistVideoChannel(channel, channelURL, playlistChannel, playlistChannelURL, canonicalChannelURL)
+
+		url := entry.URL
+		if url == "" {
+			url = entry.WebpageURL
+		}
+
+		// Keep the original playlist position so partial extractions aren't renumbered
+		index := entry.PlaylistIndex
+		if index <= 0 {
+			index = len(info.Videos) + 1
+		}
+
+		info.Videos = append(info.Videos, VideoInfo{
+			ID:         entry.ID,
+			Title:      entry.Title,
+			Channel:    channel,
+			ChannelURL: channelURL,
+			URL:        url,
+			Index:      index,
+			Duration:   int(entry.Duration),
+			UploadDate: entry.UploadDate,
+			ViewCount:  entry.ViewCount,
+			LikeCount:  entry.LikeCount,
+		})
+	}
+
+	return info, nil
+}
+
+// extractPlaylistPrint extracts playlist entries with a --print template, the
+// fallback for when yt-dlp's JSON output can't be parsed
+func extractPlaylistPrint(playlistURL, items, canonicalChannelURL string) (*PlaylistInfo, error) {
+	args := []string{
+		"--flat-playlist",
+		"--print", printTemplate("%(playlist_title,playlist)s", "%(playlist_channel,channel)s", "%(playlist_channel_url,channel_url)s",
+			"%(playlist_index)s", "%(id)s", "%(title)s", "%(channel)s", "%(channel_url)s", "%(url)s"),
+	}
+	if items != "" {
+		args = append(args, "--playlist-items", items)
+	}
+	args = append(args, matchFilterArgs()...)
+	args = append(args, playlistURL)
+
+	output, err := ytdlpOutput(PlaylistTimeout, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &PlaylistInfo{
+		Videos: make([]VideoInfo, 0),
+	}
+
+	// Fields: playlist_title, playlist_channel, playlist_channel_url, index, id, title, channel, channel_url, url
+	for _, parts := range parsePrintRecords(output, 9) {
+		// Extract playlist info from first video
+		if info.Title == "" {
+			info.Title = parts[0]
+			info.Channel = parts[1]
+			// Clean the playlist channel URL immediately
+			info.ChannelURL = CleanChannelURL(parts[2])
+		}
+
+		videoChannel, videoChannelURL := playlistVideoChannel(parts[6], parts[7], parts[1], parts[2], canonicalChannelURL)
+
+		// Keep the original playlist position so partial extractions aren't renumbered
+		index, err := strconv.Atoi(parts[3])
+		if err != nil {
+			index = len(info.Videos) + 1
+		}
+
+		video := VideoInfo{
+			ID:         parts[4],
+			Title:      parts[5],
+			Channel:    videoChannel,
+			ChannelURL: videoChannelURL,
+			URL:        parts[8],
+			Index:      index,
+		}
+		info.Videos = append(info.Videos, video)
+	}
+
+	return info, nil
+}
+
+// playlistVideoChannel fills in a playlist entry's missing channel from the playlist's own
+func playlistVideoChannel(videoChannel, videoChannelURL, playlistChannel, playlistChannelURL, canonicalChannelURL string) (string, string) {
+	// Fallback: Use playlist channel info if video channel is missing or NA
+	if videoChannel == "" || videoChannel == "NA" {
+		videoChannel = playlistChannel
+	}
+	if videoChannelURL == "" || videoChannelURL == "NA" {
+		// If we have a canonical channel URL, use it; otherwise use playlist_channel_url
+		if canonicalChannelURL != "" {
+			videoChannelURL = canonicalChannelURL
+		} else {
+			videoChannelURL = playlistChannelURL
+		}
+	}
+
+	// Clean the video channel URL
+	videoChannelURL = CleanChannelURL(videoChannelURL)
+
+	// Ensure video channel name is never empty
+	if videoChannel == "" || videoChannel == "NA" {
+		if videoChannelURL != "" && videoChannelURL != "NA" {
+			videoChannel = extractChannelNameFromURL(videoChannelURL)
+		} else {
+			videoChannel = "Unknown Channel"
+		}
+	}
+
+	// Ensure video channel URL is never empty
+	if videoChannelURL == "" || videoChannelURL == "NA" {
+		// This shouldn't happen after fallbacks, but just in case
+		videoChannelURL = ""
+	}
+
+	return videoChannel, videoChannelURL
+}
+
 // extractChannelNameFromURL extracts a readable channel name from a URL
 func extractChannelNameFromURL(urlStr string) string {
 	// For @handle format
@@ -290,7 +926,6 @@ func extractChannelNameFromURL(urlStr string) string {
 	return "Unknown Channel"
 }
 
-
 // extractChannelURL gets the canonical channel URL (with ID) from any channel URL format
 func extractChannelURL(channelURL string) string {
 	args := []string{
@@ -299,8 +934,7 @@ func extractChannelURL(channelURL string) string {
 		channelURL,
 	}
 
-	cmd := exec.Command("yt-dlp", args...)
-	output, err := cmd.Output()
+	output, err := ytdlpOutput(MetadataTimeout, args...)
 	if err != nil {
 		return ""
 	}
@@ -314,23 +948,66 @@ func extractChannelURL(channelURL string) string {
 	return "https://www.youtube.com/channel/" + channelID
 }
 
+// ExtractVideoMetadata fetches the metadata of a single video from yt-dlp's JSON output
 func ExtractVideoMetadata(videoURL string) (*VideoInfo, error) {
+	output, err := ytdlpOutput(MetadataTimeout, "-J", "--no-playlist", videoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var video videoJSON
+	if err := json.Unmarshal(output, &video); err != nil {
+		// Fall back to the --print template if yt-dlp's JSON couldn't be read
+		logger.Warn("failed to parse video JSON, retrying with --print", "url", videoURL, "error", err)
+		return extractVideoMetadataPrint(videoURL)
+	}
+
+	channel, channelURL := video.channel()
+	if channel == "NA" {
+		channel = ""
+	}
+	if channelURL == "NA" || channelURL == "" {
+		channelURL = ""
+	} else {
+		channelURL = CleanChannelURL(channelURL)
+	}
+
+	info := &VideoInfo{
+		ID:         video.ID,
+		Title:      video.Title,
+		Channel:    channel,
+		ChannelURL: channelURL,
+		URL:        videoURL,
+		Duration:   int(video.Duration),
+		UploadDate: video.UploadDate,
+		ViewCount:  video.ViewCount,
+		LikeCount:  video.LikeCount,
+		LiveStatus: video.liveStatus(),
+	}
+	if video.ReleaseTime != nil && info.LiveStatus == liveStatusUpcoming {
+		info.StartsAt = time.Unix(*video.ReleaseTime, 0)
+	}
+	return info, nil
+}
+
+// extractVideoMetadataPrint fetches video metadata with a --print template, the
+// fallback for when yt-dlp's JSON output can't be parsed
+func extractVideoMetadataPrint(videoURL string) (*VideoInfo, error) {
 	args := []string{
-		"--print", "%(id)s|%(title)s|%(channel)s|%(channel_url)s",
+		"--print", printTemplate("%(id)s", "%(title)s", "%(channel)s", "%(channel_url)s"),
 		videoURL,
 	}
 
-	cmd := exec.Command("yt-dlp", args...)
-	output, err := cmd.Output()
+	output, err := ytdlpOutput(MetadataTimeout, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	line := strings.TrimSpace(string(output))
-	parts := strings.SplitN(line, "|", 4)
-	if len(parts) != 4 {
+	records := parsePrintRecords(output, 4)
+	if len(records) == 0 {
 		return nil, fmt.Errorf("invalid metadata format")
 	}
+	parts := records[0]
 
 	channelURL := parts[3]
 	if channelURL == "NA" || channelURL == "" {
@@ -347,3 +1024,198 @@ func ExtractVideoMetadata(videoURL string) (*VideoInfo, error) {
 		URL:        videoURL,
 	}, nil
 }
+
+// ExtractVideoMetadataBatch fetches metadata for several videos with a single yt-dlp call.
+// Results are in the same order as urls; entries for URLs yt-dlp couldn't extract are nil
+func ExtractVideoMetadataBatch(urls []string) ([]*VideoInfo, error) {
+	results := make([]*VideoInfo, len(urls))
+	if len(urls) == 0 {
+		return results, nil
+	}
+
+	// Map each URL back to its positions so output order doesn't matter
+	positions := make(map[string][]int)
+	for i, u := range urls {
+		positions[u] = append(positions[u], i)
+	}
+
+	args := []string{
+		"--ignore-errors",
+		"--no-playlist",
+		"--print", printTemplate("%(original_url)s", "%(id)s", "%(channel)s", "%(channel_url)s", "%(title)s", "%(view_count)s", "%(like_count)s"),
+	}
+	args = append(args, urls...)
+
+	output, err := ytdlpOutput(PlaylistTimeout, args...)
+	if err != nil {
+		// yt-dlp exits non-zero if any URL failed; keep whatever it did print
+		var exitErr exitCoder
+		if !errors.As(err, &exitErr) || len(output) == 0 {
+			return nil, err
+		}
+	}
+
+	for _, parts := range parsePrintRecords(output, 7) {
+		idxs := positions[parts[0]]
+		if len(idxs) == 0 {
+			continue
+		}
+
+		channelURL := parts[3]
+		if channelURL == "NA" || channelURL == "" {
+			channelURL = ""
+		} else {
+			channelURL = CleanChannelURL(channelURL)
+		}
+
+		for _, idx := range idxs {
+			results[idx] = &VideoInfo{
+				ID:         parts[1],
+				Title:      parts[4],
+				Channel:    parts[2],
+				ChannelURL: channelURL,
+				URL:        urls[idx],
+				ViewCount:  parseCount(parts[5]),
+				LikeCount:  parseCount(parts[6]),
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// parseCount reads a count printed by yt-dlp, returning nil for "NA" and other unknown values
+func parseCount(s string) *int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+// Format describes one downloadable format of a video
+type Format struct {
+	ID         string
+	Ext        string
+	Resolution string // "audio only" for audio formats
+	FPS        float64
+	Filesize   int64 // Exact or approximate size in bytes, 0 if unknown (e.g. live streams)
+	VCodec     string
+	ACodec     string
+}
+
+// ListFormats prints yt-dlp's format table for a URL
+func ListFormats(url string) error {
+	return YtdlpRunner.Stream(context.Background(), []string{"-F", "--no-playlist", url}, os.Stdout, os.Stderr)
+}
+
+// GetFormats returns the formats available for a URL, parsed from yt-dlp's JSON output
+func GetFormats(url string) ([]Format, error) {
+	output, err := ytdlpOutput(MetadataTimeout, "-J", "--no-playlist", url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fields yt-dlp doesn't know (live streams, audio-only) come back as null
+	var info struct {
+		Formats []struct {
+			FormatID       string  `json:"format_id"`
+			Ext            string  `json:"ext"`
+			Resolution     string  `json:"resolution"`
+			FPS            float64 `json:"fps"`
+			Filesize       float64 `json:"filesize"`
+			FilesizeApprox float64 `json:"filesize_approx"`
+			VCodec         string  `json:"vcodec"`
+			ACodec         string  `json:"acodec"`
+		} `json:"formats"`
+	}
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse formats: %w", err)
+	}
+
+	formats := make([]Format, 0, len(info.Formats))
+	for _, f := range info.Formats {
+		size := f.Filesize
+		if size == 0 {
+			size = f.FilesizeApprox
+		}
+		formats = append(formats, Format{
+			ID:         f.FormatID,
+			Ext:        f.Ext,
+			Resolution: f.Resolution,
+			FPS:        f.FPS,
+			Filesize:   int64(size),
+			VCodec:     f.VCodec,
+			ACodec:     f.ACodec,
+		})
+	}
+	return formats, nil
+}
+
+// ThumbnailCacheDir is where thumbnails fetched for the TUI are kept
+var ThumbnailCacheDir = filepath.Join("downloads", ".thumbnails")
+
+// DownloadThumbnail fetches a video's thumbnail into destDir without downloading the video.
+// Returns the path of the thumbnail, or "" if the video has none
+func DownloadThumbnail(videoURL, destDir string) (string, error) {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", err
+	}
+
+	args := []string{
+		"--skip-download",
+		"--write-thumbnail",
+		"--no-playlist",
+		"--no-simulate",
+		"--print", "%(id)s",
+		"-o", filepath.Join(destDir, "%(id)s.%(ext)s"),
+		videoURL,
+	}
+
+	output, err := ytdlpOutput(MetadataTimeout, args...)
+	if err != nil {
+		return "", err
+	}
+
+	videoID := strings.TrimSpace(string(output))
+	if videoID == "" || videoID == "NA" {
+		return "", nil
+	}
+	return findThumbnail(destDir, videoID), nil
+}
+
+// findThumbnail returns the cached thumbnail for a video ID, whatever its image format
+func findThumbnail(dir, videoID string) string {
+	matches, err := filepath.Glob(filepath.Join(dir, videoID+".*"))
+	if err != nil || len(matches) == 0 {
+		return ""
+	}
+	return matches[0]
+}
+
+// CacheThumbnail makes sure a playlist video has a cached thumbnail and records its path.
+// Already cached thumbnails are reused without calling yt-dlp
+func CacheThumbnail(db *DB, video PlaylistVideo) (string, error) {
+	if video.ThumbnailPath != "" {
+		if _, err := os.Stat(video.ThumbnailPath); err == nil {
+			return video.ThumbnailPath, nil
+		}
+	}
+
+	path := findThumbnail(ThumbnailCacheDir, video.VideoID)
+	if path == "" {
+		var err error
+		path, err = DownloadThumbnail(video.VideoURL, ThumbnailCacheDir)
+		if err != nil {
+			return "", err
+		}
+		if path == "" {
+			return "", nil
+		}
+	}
+
+	if err := db.UpdatePlaylistVideoThumbnail(video.VideoID, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,222 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNormalizeFilenameWithFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		fallback string
+		want     string
+	}{
+		{"ascii title", "My Video Title", "dQw4w9WgXcQ", "My_Video_Title"},
+		{"keeps dots and hyphens", "part-1.final", "id", "part-1.final"},
+		{"mixed unicode", "Café del Mar 2024", "id", "Caf_del_Mar_2024"},
+		{"unicode title", "日本語", "dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"emoji title", "🎵🎶", "dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"all symbols", "!!! ??? ***", "dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"collapses to separators", " - _ - ", "dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"empty title", "", "dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"fallback is normalized too", "日本語", "a/b c", "ab_c"},
+		{"both empty", "日本語", "", "untitled"},
+		{"both collapse", "!!!", "???", "untitled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeFilenameWithFallback(tt.filename, tt.fallback)
+			if got != tt.want {
+				t.Errorf("NormalizeFilenameWithFallback(%q, %q) = %q, want %q", tt.filename, tt.fallback, got, tt.want)
+			}
+			// A normalized name is already safe, so normalizing it again changes nothing
+			if again := NormalizeFilename(got); again != got {
+				t.Errorf("NormalizeFilename(%q) = %q, want it unchanged", got, again)
+			}
+		})
+	}
+}
+
+// Every line yt-dlp writes must reach the callback before DownloadWithCallback returns,
+// or the status update that follows could race with the callback's own DB writes
+func TestDownloadWithCallbackDeliversAllLines(t *testing.T) {
+	const lines = 2000
+	useRunner(t, &fakeRunner{
+		stream: func(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for i := range lines {
+					fmt.Fprintf(stdout, "[download] stdout line %d\n", i)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := range lines {
+					fmt.Fprintf(stderr, "WARNING: stderr line %d\n", i)
+				}
+			}()
+			wg.Wait()
+			return nil
+		},
+	})
+
+	// The callback is serialized, so it needs no locking of its own
+	var stdoutLines, stderrLines int
+	err := DownloadWithCallback(DownloadOptions{URL: "https://example.com/video"}, func(line string) {
+		time.Sleep(time.Microsecond) // A slow consumer makes late lines more likely
+		if strings.HasPrefix(line, "WARNING:") {
+			stderrLines++
+		} else {
+			stdoutLines++
+		}
+	})
+	if err != nil {
+		t.Fatalf("DownloadWithCallback: %v", err)
+	}
+	if stdoutLines != lines || stderrLines != lines {
+		t.Errorf("got %d stdout and %d stderr lines, want %d of each", stdoutLines, stderrLines, lines)
+	}
+}
+
+func TestReadAndCallback(t *testing.T) {
+	long := strings.Repeat("x", 100*1024) // Over bufio.Scanner's default 64KB limit
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"lines", "first\nsecond\n", []string{"first", "second"}},
+		{"no trailing newline", "first\nsecond", []string{"first", "second"}},
+		{"crlf", "first\r\nsecond\r\n", []string{"first", "second"}},
+		{"line over 64KB", "before\n" + long + "\nafter\n", []string{"before", long, "after"}},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			readAndCallback(strings.NewReader(tt.input), func(line string) { got = append(got, line) })
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %d lines, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+
+	// A line past maxLineSize is reported and the rest of the output drained
+	r := strings.NewReader("before\n" + strings.Repeat("x", maxLineSize+1) + "\nafter\n")
+	var got []string
+	readAndCallback(r, func(line string) { got = append(got, line) })
+	if len(got) != 2 || got[0] != "before" || !strings.HasPrefix(got[1], "ERROR: failed to read yt-dlp output") {
+		t.Errorf("got %d lines ending %.80q, want the first line then an error", len(got), got[len(got)-1])
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes left unread, want the output drained", r.Len())
+	}
+}
+
+func TestParseProgressLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want ProgressEvent
+		ok   bool
+	}{
+		{
+			"[download]  45.3% of   10.50MiB at    2.30MiB/s ETA 00:03",
+			ProgressEvent{Percent: 45.3, ETA: "00:03", Speed: "2.30MiB/s", TotalSize: "10.50MiB"}, true,
+		},
+		{
+			"[download] 100% of   10.50MiB in 00:00:04 at 2.45MiB/s",
+			ProgressEvent{Percent: 100, Speed: "2.45MiB/s", TotalSize: "10.50MiB"}, true,
+		},
+		{
+			"[download]   3.0% of ~  250.00MiB at    1.00MiB/s ETA 04:05 (frag 3/100)",
+			ProgressEvent{Percent: 3, ETA: "04:05", Speed: "1.00MiB/s", TotalSize: "~250.00MiB", Fragment: 3, FragmentTotal: 100}, true,
+		},
+		{
+			"[download]  12.5% of   1.20GiB at  Unknown B/s ETA Unknown",
+			ProgressEvent{Percent: 12.5, TotalSize: "1.20GiB"}, true,
+		},
+		{
+			"[download]  50.0% of   10.00MiB at    2.00MiB/s ETA 01:02:03",
+			ProgressEvent{Percent: 50, ETA: "01:02:03", Speed: "2.00MiB/s", TotalSize: "10.00MiB"}, true,
+		},
+		// Live streams don't know their length or fragment count
+		{
+			"[download]   15.20MiB at    1.50MiB/s (00:00:10) (frag 7/NA)",
+			ProgressEvent{Percent: -1, Speed: "1.50MiB/s", Fragment: 7}, true,
+		},
+		{
+			"[download] Unknown% of Unknown B at  500.00KiB/s ETA Unknown",
+			ProgressEvent{Percent: -1, Speed: "500.00KiB/s"}, true,
+		},
+
+		// Not progress
+		{"[download] Destination: /downloads/video.mp4", ProgressEvent{}, false},
+		{"[download] /downloads/video.mp4 has already been downloaded", ProgressEvent{}, false},
+		{"[download] Downloading item 3 of 10", ProgressEvent{}, false},
+		{"[download] Video 50% of the way does not pass filter", ProgressEvent{}, false},
+		{"[youtube] dQw4w9WgXcQ: Downloading webpage", ProgressEvent{}, false},
+		{"ERROR: [youtube] dQw4w9WgXcQ: 45.3% of nothing", ProgressEvent{}, false},
+		{"", ProgressEvent{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseProgressLine(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseProgressLine(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBuildYtdlpArgs(t *testing.T) {
+	const url = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	tests := []struct {
+		name        string
+		opts        DownloadOptions
+		matchFilter string
+		want        []string
+	}{
+		{"url only", DownloadOptions{URL: url}, "", []string{url}},
+		{
+			"everything",
+			DownloadOptions{URL: url, OutputPath: "downloads/%(title)s.%(ext)s", Format: "bv*+ba/b", ExtraArgs: []string{"--newline", "--embed-metadata"}, RestrictFilenames: true},
+			"",
+			[]string{"--restrict-filenames", "-o", "downloads/%(title)s.%(ext)s", "-f", "bv*+ba/b", "--newline", "--embed-metadata", url},
+		},
+		{
+			"match filter",
+			DownloadOptions{URL: url, ExtraArgs: []string{"--newline"}},
+			"duration > 60",
+			[]string{"--match-filter", "duration > 60", "--newline", url},
+		},
+		// An explicit --match-filter replaces the global one
+		{
+			"own match filter",
+			DownloadOptions{URL: url, ExtraArgs: []string{"--match-filter=!is_live"}},
+			"duration > 60",
+			[]string{"--match-filter=!is_live", url},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := MatchFilter
+			MatchFilter = tt.matchFilter
+			t.Cleanup(func() { MatchFilter = old })
+
+			if got := buildYtdlpArgs(tt.opts); !slices.Equal(got, tt.want) {
+				t.Errorf("buildYtdlpArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}